@@ -0,0 +1,90 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"payment-system-one/cmd/server"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/repository"
+	"payment-system-one/internal/util"
+	"payment-system-one/internal/validation"
+	"strings"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// bootstrapPassword checks the superadmin's password with the password rule
+type bootstrapPassword struct {
+	Password string `json:"password" binding:"password"`
+}
+
+// Creates the very first superadmin, who can then invite every other admin.
+// The password is read from BOOTSTRAP_ADMIN_PASSWORD, or from standard input.
+//
+//	go run ./cmd/bootstrap -email admin@example.com -first-name Ada -last-name Obi
+func main() {
+	email := flag.String("email", "", "email of the superadmin")
+	firstName := flag.String("first-name", "", "first name of the superadmin")
+	lastName := flag.String("last-name", "", "last name of the superadmin")
+	flag.Parse()
+
+	if !util.IsValidEmail(*email) {
+		log.Fatal("a valid -email is required")
+	}
+
+	//Gets the environment variables
+	env := server.InitDBParams()
+
+	if err := validation.Register(env.Handler.DefaultPhoneCountryCode); err != nil {
+		log.Fatalf("register validation rules: %s", err)
+	}
+
+	password := os.Getenv("BOOTSTRAP_ADMIN_PASSWORD")
+	if password == "" {
+		fmt.Print("Password: ")
+		line, err := bufio.NewReader(os.Stdin).ReadString('\n')
+		if err != nil && line == "" {
+			log.Fatalf("read password: %s", err)
+		}
+		password = strings.TrimRight(line, "\r\n")
+	}
+	if password == "" {
+		log.Fatal("a password is required")
+	}
+	// the same rule admins registering from an invitation are held to
+	if err := binding.Validator.ValidateStruct(&bootstrapPassword{Password: password}); err != nil {
+		log.Fatal(validation.Errors(err)[0].Message)
+	}
+
+	hashPass, err := util.HashPassword(password)
+	if err != nil {
+		log.Fatalf("could not hash password: %s", err)
+	}
+
+	//Initializes the database
+	db, err := repository.Initialize(env.DbUrl)
+	if err != nil {
+		log.Fatalf("could not connect to the database: %s", err)
+	}
+
+	admin := &models.Admin{
+		FirstName: *firstName,
+		LastName:  *lastName,
+		Email:     *email,
+		Password:  hashPass,
+	}
+	err = repository.NewDB(db).CreateFirstSuperAdmin(admin)
+	if errors.Is(err, ports.ErrAdminExists) {
+		log.Fatal("a superadmin already exists, invite new admins from the admin API")
+	}
+	if err != nil {
+		log.Fatalf("could not create superadmin: %s", err)
+	}
+
+	log.Printf("superadmin %s created\n", admin.Email)
+}
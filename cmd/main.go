@@ -16,7 +16,7 @@ func main() {
 	}
 
 	//Runs the app
-	server.Run(db, env.Port)
+	server.Run(db, env)
 }
 
 //comments are extremely important when writing functions
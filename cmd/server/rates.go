@@ -0,0 +1,73 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/validation"
+
+	"github.com/gin-gonic/gin/binding"
+)
+
+// loadExchangeRates saves the rates in a JSON file such as
+// [{"base_currency": "USD", "quote_currency": "NGN", "rate": "1550.25", "spread_bps": 150}]
+// replacing the stored rate of each pair. Pairs without a spread get defaultSpreadBps.
+// Every row is checked with the rules SetExchangeRate applies before any is saved, and the
+// first invalid row fails the load. The rows are saved in one database transaction, so a
+// failed save leaves the stored rates as they were.
+func loadExchangeRates(repository ports.Repository, path string, defaultSpreadBps int64) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	requests := []models.ExchangeRateRequest{}
+	if err := json.Unmarshal(data, &requests); err != nil {
+		return err
+	}
+
+	rates := make([]*models.ExchangeRate, 0, len(requests))
+	seen := map[[2]string]int{}
+	for i, request := range requests {
+		row := i + 1
+		if err := binding.Validator.ValidateStruct(&request); err != nil {
+			return fmt.Errorf("%s row %d: %s", path, row, validation.Errors(err)[0].Message)
+		}
+
+		// a pair is stored one way round only
+		pair := [2]string{request.BaseCurrency, request.QuoteCurrency}
+		if pair[0] > pair[1] {
+			pair[0], pair[1] = pair[1], pair[0]
+		}
+		if previous, ok := seen[pair]; ok {
+			return fmt.Errorf("%s row %d: %s/%s is already set in row %d", path, row,
+				request.BaseCurrency, request.QuoteCurrency, previous)
+		}
+		seen[pair] = row
+
+		existing, err := repository.FindExchangeRate(request.BaseCurrency, request.QuoteCurrency)
+		if err == nil && existing.BaseCurrency != request.BaseCurrency {
+			return fmt.Errorf("%s row %d: set the rate as %s/%s", path, row, existing.BaseCurrency, existing.QuoteCurrency)
+		}
+		if err != nil && !errors.Is(err, ports.ErrExchangeRateNotFound) {
+			return err
+		}
+
+		spreadBps := defaultSpreadBps
+		if request.SpreadBps != nil {
+			spreadBps = *request.SpreadBps
+		}
+
+		rates = append(rates, &models.ExchangeRate{
+			BaseCurrency:  request.BaseCurrency,
+			QuoteCurrency: request.QuoteCurrency,
+			Rate:          request.Rate,
+			SpreadBps:     spreadBps,
+		})
+	}
+
+	return repository.SaveExchangeRates(rates)
+}
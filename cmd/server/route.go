@@ -3,20 +3,27 @@ package server
 import (
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
+	"log"
 	"payment-system-one/internal/api"
 	"payment-system-one/internal/middleware"
+	"payment-system-one/internal/models"
 	"payment-system-one/internal/ports"
 	"time"
 )
 
-// SetupRouter is where router endpoints are called
-func SetupRouter(handler *api.HTTPHandler, repository ports.Repository) *gin.Engine {
+// SetupRouter is where router endpoints are called. The client IP is only taken from
+// X-Forwarded-For when the request comes from one of trustedProxies, so without any it is always
+// the address of the peer.
+func SetupRouter(handler *api.HTTPHandler, repository ports.Repository, idempotencyWindow, idempotencyTimeout time.Duration, trustedProxies []string) *gin.Engine {
 	router := gin.Default()
+	if err := router.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("invalid TRUSTED_PROXIES: %s\n", err)
+	}
 	router.Use(cors.New(cors.Config{
 		AllowOrigins:     []string{"*"},
 		AllowMethods:     []string{"POST", "GET", "PUT", "PATCH", "DELETE"},
 		AllowHeaders:     []string{"*"},
-		ExposeHeaders:    []string{"Content-Length"},
+		ExposeHeaders:    []string{"Content-Length", "Content-Disposition", "Idempotent-Replayed"},
 		AllowCredentials: true,
 		MaxAge:           12 * time.Hour,
 	}))
@@ -26,28 +33,69 @@ func SetupRouter(handler *api.HTTPHandler, repository ports.Repository) *gin.Eng
 		r.GET("/", handler.Readiness)
 		r.POST("/create", handler.RegisterUser)
 		r.POST("/login", handler.LoginUser)
-		r.POST("/admin/create", handler.RegisterAdmin)
+		r.POST("/admin/register", handler.RegisterAdmin)
 		r.POST("/admin/login", handler.LoginAdmin)
+		r.POST("/token/refresh", handler.RefreshToken)
+		r.GET("/.well-known/jwks.json", handler.JWKS)
+		r.GET("/errors", handler.ErrorCatalogue)
+		r.POST("/2fa/enrol", handler.EnrolMFA)
+		r.POST("/2fa/verify", handler.VerifyMFA)
+		r.POST("/password/forgot", handler.ForgotPassword)
+		r.POST("/password/reset", handler.ResetPassword)
+		r.POST("/email/verify", handler.VerifyEmail)
 	}
 
 	// authorizeUser authorizes all authorized users handlers
 	authorizeUser := r.Group("/user")
-	authorizeUser.Use(middleware.AuthorizeAdmin(repository.FindUserByEmail, repository.TokenInBlacklist))
+	authorizeUser.Use(middleware.AuthorizeUser(handler.Config.Keys, repository.FindUserByEmail, repository.TokenInBlacklist))
+	// idempotent lets clients safely retry money-moving requests with an Idempotency-Key header
+	idempotent := middleware.Idempotency(repository, idempotencyWindow, idempotencyTimeout)
+	// verified keeps money from moving until the user has verified their email
+	verified := middleware.RequireVerifiedEmail()
 	{
-		authorizeUser.POST("/transfer", handler.TransferFunds)
-		authorizeUser.POST("/addfunds", handler.AddMoney)
+		authorizeUser.POST("/transfer", verified, idempotent, handler.TransferFunds)
+		authorizeUser.POST("/addfunds", verified, idempotent, handler.AddMoney)
 		authorizeUser.GET("/transaction", handler.UserTransactionHistory)
+		authorizeUser.GET("/transaction/:reference", handler.TransactionByReference)
+		authorizeUser.GET("/transaction/:reference/receipt", handler.TransactionReceipt)
 		authorizeUser.GET("/balance", handler.BalanceCheck)
+		authorizeUser.POST("/wallet", handler.OpenWallet)
+		authorizeUser.GET("/fx/rates", handler.ExchangeRates)
+		authorizeUser.POST("/fx/quote", handler.FXQuote)
+		authorizeUser.POST("/fx/convert", verified, idempotent, handler.FXConvert)
 		authorizeUser.GET("/dashboard", handler.Dashboard)
+		authorizeUser.POST("/logout", handler.Logout)
+		authorizeUser.POST("/logout-all", handler.LogoutAll)
+		authorizeUser.POST("/2fa/enrol", handler.EnrolTOTP)
+		authorizeUser.POST("/2fa/confirm", handler.ConfirmTOTP)
+		authorizeUser.POST("/2fa/disable", handler.DisableTOTP)
+		authorizeUser.POST("/2fa/recovery-codes", handler.RegenerateRecoveryCodes)
+		authorizeUser.PUT("/pin", handler.SetPIN)
+		authorizeUser.POST("/pin/change", handler.ChangePIN)
+		authorizeUser.PUT("/password", handler.ChangePassword)
+		authorizeUser.POST("/email/verify/resend", handler.ResendEmailVerification)
+		authorizeUser.POST("/phone/otp", handler.SendPhoneOTP)
+		authorizeUser.POST("/phone/verify", handler.VerifyPhone)
 
 	}
 
-	// authorizeAdmin authorizes all authorized users handlers
+	// authorizeAdmin authorizes all authorized admins handlers, each route checks the permission it needs
 	authorizeAdmin := r.Group("/admin")
-	authorizeAdmin.Use(middleware.AuthorizeAdmin(repository.FindUserByEmail, repository.TokenInBlacklist))
+	authorizeAdmin.Use(middleware.AuthorizeAdmin(handler.Config.Keys, repository.FindAdminByEmail, repository.TokenInBlacklist))
 	{
-		authorizeAdmin.GET("/user", handler.GetUserByEmail)
-
+		authorizeAdmin.GET("/user", middleware.RequirePermission(models.PermissionViewUsers), handler.GetUserByEmail)
+		authorizeAdmin.GET("/ledger/reconcile", middleware.RequirePermission(models.PermissionReconcileLedger), handler.ReconcileBalance)
+		authorizeAdmin.PUT("/fx/rates", middleware.RequirePermission(models.PermissionManageRates), handler.SetExchangeRate)
+		authorizeAdmin.POST("/transaction/:id/reverse", middleware.RequirePermission(models.PermissionReverse), handler.ReverseTransaction)
+		authorizeAdmin.GET("/transaction/:id/reversals", middleware.RequirePermission(models.PermissionViewTransactions), handler.TransactionReversals)
+		authorizeAdmin.PUT("/:id/role", middleware.RequirePermission(models.PermissionManageAdmins), handler.SetAdminRole)
+		authorizeAdmin.POST("/invitations", middleware.RequirePermission(models.PermissionManageAdmins), handler.InviteAdmin)
+		authorizeAdmin.POST("/logout", handler.Logout)
+		authorizeAdmin.POST("/logout-all", handler.LogoutAll)
+		authorizeAdmin.POST("/2fa/recovery-codes", handler.RegenerateRecoveryCodes)
+		authorizeAdmin.DELETE("/user/:id/2fa", middleware.RequirePermission(models.PermissionResetMFA), handler.ResetUserTOTP)
+		authorizeAdmin.DELETE("/user/:id/lockout", middleware.RequirePermission(models.PermissionUnlockUsers), handler.UnlockUserLogin)
+		authorizeAdmin.DELETE("/:id/lockout", middleware.RequirePermission(models.PermissionManageAdmins), handler.UnlockAdminLogin)
 	}
 
 	return router
@@ -10,23 +10,61 @@ import (
 	"os"
 	"os/signal"
 	"payment-system-one/internal/api"
+	"payment-system-one/internal/middleware"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/notifier"
+	"payment-system-one/internal/ports"
 	"payment-system-one/internal/repository"
+	"payment-system-one/internal/validation"
+	"strconv"
+	"strings"
 	"time"
 )
 
 // Run injects all dependencies needed to run the app
-func Run(db *gorm.DB, port string) {
+func Run(db *gorm.DB, params Params) {
 	newRepo := repository.NewDB(db)
 
-	Handler := api.NewHTTPHandler(newRepo)
-	router := SetupRouter(Handler, newRepo)
+	if err := validation.Register(params.Handler.DefaultPhoneCountryCode); err != nil {
+		log.Fatalf("register validation rules: %s\n", err)
+	}
+
+	if params.FXRatesFile != "" {
+		if err := loadExchangeRates(newRepo, params.FXRatesFile, params.Handler.FXSpreadBps); err != nil {
+			log.Fatalf("load exchange rates: %s\n", err)
+		}
+	}
+
+	var newNotifier ports.Notifier
+	switch params.Notifier {
+	case "file":
+		newNotifier = notifier.NewFile(params.NotifierFile)
+	case "smtp":
+		newNotifier = notifier.NewSMTP(params.SMTP.Host, params.SMTP.Port, params.SMTP.Username, params.SMTP.Password, params.SMTP.From)
+	default:
+		newNotifier = notifier.NewLog()
+	}
+
+	var newSMS ports.SMSSender
+	switch params.SMSSender {
+	case "memory":
+		newSMS = notifier.NewSMSInbox()
+	default:
+		newSMS = notifier.NewSMSFile(params.SMSFile)
+	}
+
+	Handler := api.NewHTTPHandler(newRepo, newNotifier, newSMS, params.Handler)
+	router := SetupRouter(Handler, newRepo, params.IdempotencyWindow, params.IdempotencyTimeout, params.TrustedProxies)
+
+	go pruneIdempotencyKeys(newRepo, time.Hour)
+	go pruneBlacklist(newRepo, time.Hour)
 
 	srv := &http.Server{
-		Addr:    ":" + port,
+		Addr:    ":" + params.Port,
 		Handler: router,
 	}
 
-	fmt.Printf("Listening and serving HTTP on : %v\n", port)
+	fmt.Printf("Listening and serving HTTP on : %v\n", params.Port)
 
 	go func() {
 		if err := srv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
@@ -34,7 +72,7 @@ func Run(db *gorm.DB, port string) {
 		}
 	}()
 
-	sigChan := make(chan os.Signal)
+	sigChan := make(chan os.Signal, 1)
 	signal.Notify(sigChan, os.Interrupt)
 	signal.Notify(sigChan, os.Kill)
 
@@ -56,6 +94,36 @@ func Run(db *gorm.DB, port string) {
 type Params struct {
 	Port  string
 	DbUrl string
+	// IdempotencyWindow is how long an Idempotency-Key is remembered
+	IdempotencyWindow time.Duration
+	// IdempotencyTimeout is how long a request holds its Idempotency-Key before a retry may take it over
+	IdempotencyTimeout time.Duration
+	// TrustedProxies are the addresses or CIDR ranges of reverse proxies allowed to set the
+	// client IP with X-Forwarded-For, none by default
+	TrustedProxies []string
+	// FXRatesFile is an optional JSON file of exchange rates loaded at startup
+	FXRatesFile string
+	// Notifier is how notifications are delivered: file (the default), appending to
+	// NotifierFile, log, writing who they are for without their content, or smtp, emailing
+	// them through the SMTP server
+	Notifier     string
+	NotifierFile string
+	SMTP         SMTPParams
+	// SMSSender is how texts are delivered: file (the default), appending to SMSFile, or memory,
+	// keeping them in an in-memory inbox
+	SMSSender string
+	SMSFile   string
+	// Handler holds the settings passed to the HTTP handlers
+	Handler api.Config
+}
+
+// SMTPParams is the SMTP server notifications are emailed through
+type SMTPParams struct {
+	Host     string
+	Port     string
+	Username string
+	Password string
+	From     string
 }
 
 // InitDBParams gets environment variables needed to run the app
@@ -71,8 +139,221 @@ func InitDBParams() Params {
 		port = "8080"
 	}
 
+	transferFee := models.NewMoney(0, models.DefaultCurrency)
+	if fee := os.Getenv("TRANSFER_FEE"); fee != "" {
+		parsed, err := models.ParseMoney(fee, models.DefaultCurrency)
+		if err != nil {
+			log.Fatalf("invalid TRANSFER_FEE: %s\n", err)
+		}
+		transferFee = parsed
+	}
+
+	idempotencyWindow := durationEnv("IDEMPOTENCY_KEY_TTL", 24*time.Hour)
+	idempotencyTimeout := durationEnv("IDEMPOTENCY_IN_PROGRESS_TIMEOUT", time.Minute)
+
+	var trustedProxies []string
+	for _, proxy := range strings.Split(os.Getenv("TRUSTED_PROXIES"), ",") {
+		if proxy = strings.TrimSpace(proxy); proxy != "" {
+			trustedProxies = append(trustedProxies, proxy)
+		}
+	}
+	fxQuoteTTL := durationEnv("FX_QUOTE_TTL", 30*time.Second)
+
+	var fxSpreadBps int64 = 100
+	if spread := os.Getenv("FX_SPREAD_BPS"); spread != "" {
+		parsed, err := strconv.ParseInt(spread, 10, 64)
+		if err != nil || parsed < 0 || parsed >= 10000 {
+			log.Fatalf("invalid FX_SPREAD_BPS: %q\n", spread)
+		}
+		fxSpreadBps = parsed
+	}
+
+	reversalAllowNegative := false
+	if allow := os.Getenv("REVERSAL_ALLOW_NEGATIVE"); allow != "" {
+		parsed, err := strconv.ParseBool(allow)
+		if err != nil {
+			log.Fatalf("invalid REVERSAL_ALLOW_NEGATIVE: %q\n", allow)
+		}
+		reversalAllowNegative = parsed
+	}
+
+	keysDir := os.Getenv("JWT_KEYS_DIR")
+	if keysDir == "" {
+		keysDir = "keys"
+	}
+	issuer := os.Getenv("JWT_ISSUER")
+	if issuer == "" {
+		issuer = "payment-system-one"
+	}
+	clockSkew := nonNegativeDurationEnv("JWT_CLOCK_SKEW", 30*time.Second)
+	signingKeyID := os.Getenv("JWT_SIGNING_KEY_ID")
+	if signingKeyID == "" {
+		log.Fatalf("JWT_SIGNING_KEY_ID is not set: create a key with make jwt-key KID=<kid> and set it to the kid\n")
+	}
+	keys, err := middleware.LoadKeySet(keysDir, signingKeyID, issuer, clockSkew)
+	if err != nil {
+		log.Fatalf("load JWT keys: %s (create it with make jwt-key KID=%s)\n", err, signingKeyID)
+	}
+
+	totpIssuer := os.Getenv("TOTP_ISSUER")
+	if totpIssuer == "" {
+		totpIssuer = "Payment System One"
+	}
+
+	pinMaxAttempts := intEnv("PIN_MAX_ATTEMPTS", 5)
+	pinLockout := durationEnv("PIN_LOCKOUT", 30*time.Minute)
+	loginMaxFailures := intEnv("LOGIN_MAX_FAILURES", 5)
+	loginIPMaxFailures := intEnv("LOGIN_IP_MAX_FAILURES", 20)
+	loginLockout := durationEnv("LOGIN_LOCKOUT", 15*time.Minute)
+	passwordResetTTL := durationEnv("PASSWORD_RESET_TTL", time.Hour)
+	passwordResetInterval := nonNegativeDurationEnv("PASSWORD_RESET_INTERVAL", time.Minute)
+
+	notifierKind := os.Getenv("NOTIFIER")
+	notifierFile := os.Getenv("NOTIFIER_FILE")
+	switch notifierKind {
+	case "log":
+	case "", "file":
+		notifierKind = "file"
+		if notifierFile == "" {
+			notifierFile = "notifications.log"
+		}
+	case "smtp":
+		if os.Getenv("SMTP_HOST") == "" || os.Getenv("SMTP_FROM") == "" {
+			log.Fatalf("SMTP_HOST and SMTP_FROM are required with NOTIFIER=smtp\n")
+		}
+	default:
+		log.Fatalf("invalid NOTIFIER: %q\n", notifierKind)
+	}
+
+	smtpPort := os.Getenv("SMTP_PORT")
+	if smtpPort == "" {
+		smtpPort = "587"
+	}
+
+	emailVerificationTTL := durationEnv("EMAIL_VERIFICATION_TTL", 24*time.Hour)
+	emailVerificationResendInterval := nonNegativeDurationEnv("EMAIL_VERIFICATION_RESEND_INTERVAL", time.Minute)
+
+	smsSender := os.Getenv("SMS_SENDER")
+	smsFile := os.Getenv("SMS_FILE")
+	switch smsSender {
+	case "", "file":
+		if smsFile == "" {
+			smsFile = "sms.log"
+		}
+	case "memory":
+	default:
+		log.Fatalf("invalid SMS_SENDER: %q\n", smsSender)
+	}
+
+	defaultPhoneCountryCode := os.Getenv("DEFAULT_PHONE_COUNTRY_CODE")
+	if defaultPhoneCountryCode == "" {
+		defaultPhoneCountryCode = "234"
+	}
+	if _, err := strconv.ParseUint(defaultPhoneCountryCode, 10, 16); err != nil || len(defaultPhoneCountryCode) > 3 || defaultPhoneCountryCode[0] == '0' {
+		log.Fatalf("invalid DEFAULT_PHONE_COUNTRY_CODE: %q\n", defaultPhoneCountryCode)
+	}
+
+	phoneOTPTTL := durationEnv("PHONE_OTP_TTL", 5*time.Minute)
+	phoneOTPMaxAttempts := intEnv("PHONE_OTP_MAX_ATTEMPTS", 5)
+	phoneOTPResendInterval := nonNegativeDurationEnv("PHONE_OTP_RESEND_INTERVAL", time.Minute)
+	adminInvitationTTL := durationEnv("ADMIN_INVITATION_TTL", 72*time.Hour)
+
 	return Params{
-		Port:  port,
-		DbUrl: dbURL,
+		Port:               port,
+		DbUrl:              dbURL,
+		IdempotencyWindow:  idempotencyWindow,
+		IdempotencyTimeout: idempotencyTimeout,
+		TrustedProxies:     trustedProxies,
+		FXRatesFile:        os.Getenv("FX_RATES_FILE"),
+		Notifier:           notifierKind,
+		NotifierFile:       notifierFile,
+		SMTP: SMTPParams{
+			Host:     os.Getenv("SMTP_HOST"),
+			Port:     smtpPort,
+			Username: os.Getenv("SMTP_USERNAME"),
+			Password: os.Getenv("SMTP_PASSWORD"),
+			From:     os.Getenv("SMTP_FROM"),
+		},
+		SMSSender: smsSender,
+		SMSFile:   smsFile,
+		Handler: api.Config{
+			TransferFee:                     transferFee,
+			FXQuoteTTL:                      fxQuoteTTL,
+			FXSpreadBps:                     fxSpreadBps,
+			ReversalAllowNegative:           reversalAllowNegative,
+			AdminInvitationTTL:              adminInvitationTTL,
+			Keys:                            keys,
+			TOTPIssuer:                      totpIssuer,
+			PINMaxAttempts:                  pinMaxAttempts,
+			PINLockout:                      pinLockout,
+			LoginMaxFailures:                loginMaxFailures,
+			LoginIPMaxFailures:              loginIPMaxFailures,
+			LoginLockout:                    loginLockout,
+			PasswordResetTTL:                passwordResetTTL,
+			PasswordResetURL:                os.Getenv("PASSWORD_RESET_URL"),
+			PasswordResetInterval:           passwordResetInterval,
+			EmailVerificationTTL:            emailVerificationTTL,
+			EmailVerificationURL:            os.Getenv("EMAIL_VERIFICATION_URL"),
+			EmailVerificationResendInterval: emailVerificationResendInterval,
+			DefaultPhoneCountryCode:         defaultPhoneCountryCode,
+			PhoneOTPTTL:                     phoneOTPTTL,
+			PhoneOTPMaxAttempts:             phoneOTPMaxAttempts,
+			PhoneOTPResendInterval:          phoneOTPResendInterval,
+		},
+	}
+}
+
+// durationEnv returns the duration in the environment variable name, or def if it is unset. It
+// exits if the variable is not a positive duration.
+func durationEnv(name string, def time.Duration) time.Duration {
+	d := nonNegativeDurationEnv(name, def)
+	if d == 0 {
+		log.Fatalf("invalid %s: %q\n", name, os.Getenv(name))
+	}
+	return d
+}
+
+// nonNegativeDurationEnv is durationEnv for durations that can be zero
+func nonNegativeDurationEnv(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil || d < 0 {
+		log.Fatalf("invalid %s: %q\n", name, value)
+	}
+	return d
+}
+
+// intEnv returns the number in the environment variable name, or def if it is unset. It exits if
+// the variable is not a positive whole number.
+func intEnv(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil || n <= 0 {
+		log.Fatalf("invalid %s: %q\n", name, value)
+	}
+	return n
+}
+
+// pruneIdempotencyKeys deletes expired idempotency keys every interval
+func pruneIdempotencyKeys(store ports.IdempotencyStore, interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := store.PruneIdempotencyKeys(); err != nil {
+			log.Printf("prune idempotency keys errors: %v\n", err)
+		}
+	}
+}
+
+// pruneBlacklist deletes the blacklist entries of expired tokens every interval
+func pruneBlacklist(repository ports.Repository, interval time.Duration) {
+	for range time.Tick(interval) {
+		if _, err := repository.PruneBlacklist(); err != nil {
+			log.Printf("prune blacklist errors: %v\n", err)
+		}
 	}
 }
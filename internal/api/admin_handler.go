@@ -1,98 +1,203 @@
 package api
 
 import (
-	"net/http"
-	"os"
+	"errors"
+	"payment-system-one/internal/apperror"
 	"payment-system-one/internal/middleware"
 	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
 	"payment-system-one/internal/util"
+	"payment-system-one/internal/validation"
+	"strconv"
+	"time"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 )
 
-func (u *HTTPHandler) RegisterAdmin(c *gin.Context) {
-	var admin *models.Admin
-	if err := c.ShouldBind(&admin); err != nil {
-		util.Response(c, "invalid request", 400, "bad request body", nil)
+// InviteAdmin issues a signed, single-use, expiring invitation for someone to register as an admin
+func (u *HTTPHandler) InviteAdmin(c *gin.Context) {
+	invitationRequest := &models.AdminInvitationRequest{}
+	if !bindRequest(c, invitationRequest) {
 		return
 	}
 
-	//validate admin email
-	if !util.IsValidEmail(admin.Email) {
-		util.Response(c, "invalid email", 400, "Bad request body", nil)
+	admin, err := u.GetAdminFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
 		return
 	}
 
 	//check if admin already exists
-	_, err := u.Repository.FindAdminByEmail(admin.Email)
+	_, err = u.Repository.FindAdminByEmail(invitationRequest.Email)
 	if err == nil {
-		util.Response(c, "admin already exists", 400, "Bad request body", nil)
+		apperror.Respond(c, apperror.New(apperror.CodeAccountExists, "admin already exists"))
+		return
+	}
+	if !errors.Is(err, ports.ErrAdminNotFound) {
+		apperror.Respond(c, apperror.Unexpected(err, "could not create invitation"))
+		return
+	}
+
+	tokenID, err := util.GenerateTokenID()
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not create invitation"))
 		return
 	}
 
-	hashPass, err := util.HashPassword(admin.Password)
+	invitation := &models.AdminInvitation{
+		TokenID:   tokenID,
+		Email:     invitationRequest.Email,
+		Role:      invitationRequest.Role,
+		InvitedBy: admin.ID,
+		ExpiresAt: time.Now().Add(u.Config.AdminInvitationTTL),
+	}
+
+	claims := middleware.GenerateInvitationClaims(invitation.TokenID, invitation.Email, invitation.ExpiresAt)
+	token, err := middleware.GenerateToken(u.Config.Keys, claims)
 	if err != nil {
-		util.Response(c, "could not hash password", 500, "internal server error", nil)
+		apperror.Respond(c, apperror.Unexpected(err, "could not create invitation"))
+		return
+	}
+
+	if err := u.Repository.CreateAdminInvitation(invitation); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not create invitation"))
+		return
+	}
+
+	util.Response(c, "invitation created", 200, gin.H{
+		"invitation": models.NewAdminInvitationResponse(invitation),
+		"token":      token,
+	}, nil)
+}
+
+// RegisterAdmin registers an admin with an invitation token. The email and role come from the invitation.
+func (u *HTTPHandler) RegisterAdmin(c *gin.Context) {
+	registration := &models.AdminRegistrationRequest{}
+	if !bindRequest(c, registration) {
 		return
 	}
 
-	admin.Password = hashPass
+	_, claims, err := middleware.AuthorizeToken(&registration.Token, u.Config.Keys, middleware.AudienceAdminInvitation)
+	if err != nil {
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeInvalidInvitation, ports.ErrInvitationInvalid.Error()))
+		return
+	}
+	tokenID, _ := claims["jti"].(string)
+
+	phone := ""
+	if registration.Phone != "" {
+		phone, err = util.NormalizePhone(registration.Phone, u.Config.DefaultPhoneCountryCode)
+		if err != nil {
+			invalidField(c, "phone", validation.CodeInvalidPhone, err.Error())
+			return
+		}
+	}
 
-	//persist information in the data base
-	err = u.Repository.CreateAdmin(admin)
+	hashPass, err := util.HashPassword(registration.Password)
 	if err != nil {
-		util.Response(c, "admin not created", 400, err.Error(), nil)
+		apperror.Respond(c, apperror.Unexpected(err, "could not hash password"))
+		return
+	}
+
+	admin := &models.Admin{
+		FirstName:   registration.FirstName,
+		LastName:    registration.LastName,
+		Password:    hashPass,
+		DateOfBirth: registration.DateOfBirth,
+		Phone:       phone,
+		Address:     registration.Address,
+	}
+
+	//persist information in the data base, this uses the invitation up
+	err = u.Repository.AcceptAdminInvitation(tokenID, admin)
+	if errors.Is(err, ports.ErrInvitationInvalid) {
+		apperror.Respond(c, err)
+		return
+	}
+	if errors.Is(err, ports.ErrAdminExists) {
+		apperror.Respond(c, apperror.New(apperror.CodeAccountExists, "admin already exists"))
+		return
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "admin not created"))
 		return
 	}
 	util.Response(c, "admin created", 200, "success", nil)
 }
 
 func (u *HTTPHandler) LoginAdmin(c *gin.Context) {
-	var loginRequest *models.LoginRequest
-	if err := c.ShouldBind(&loginRequest); err != nil {
-		util.Response(c, "invalid request", 400, "bad request body", nil)
+	loginRequest := &models.LoginRequest{}
+	if !bindRequest(c, loginRequest) {
 		return
 	}
 
-	if loginRequest.Email == "" || loginRequest.Password == "" {
-		util.Response(c, "Please enter your email and/or password", 400, "bad request body", nil)
+	accountKey := loginAccountKey(models.AudienceAdmin, loginRequest.Email)
+	if !u.reserveLoginAttempt(c, accountKey) {
 		return
 	}
 
+	// an unknown email and a wrong password get the same answer in the same time
 	admin, err := u.Repository.FindAdminByEmail(loginRequest.Email)
 	if err != nil {
-		util.Response(c, "admin does not exist", 404, "admin not found", nil)
+		admin = &models.Admin{}
+	}
+	if !checkPassword(admin.Password, loginRequest.Password) {
+		apperror.Respond(c, apperror.New(apperror.CodeInvalidCredentials, "invalid email or password"))
 		return
 	}
+	if !u.releaseLoginAttempt(c, accountKey) {
+		return
+	}
+	// two-factor authentication is mandatory for admins, those without it enrol before they get a session
+	u.requireSecondFactor(c, models.AudienceAdmin, admin.ID, !admin.TOTPEnabled)
+}
 
-	if err = bcrypt.CompareHashAndPassword([]byte(admin.Password), []byte(loginRequest.Password)); err != nil {
-		util.Response(c, "invalid email or password", 400, "invalid email or password", nil)
+// ReconcileBalance compares a user's stored balance with the balance derived from the ledger
+func (u *HTTPHandler) ReconcileBalance(c *gin.Context) {
+	accountNo, err := strconv.Atoi(c.Query("account_no"))
+	if err != nil {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "account_no must be an account number"))
 		return
 	}
 
-	//Generate token
-	accessClaims, refreshClaims := middleware.GenerateClaims(admin.Email)
+	reconciliation, err := u.Repository.ReconcileBalance(accountNo)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not reconcile balance"))
+		return
+	}
 
-	secret := os.Getenv("JWT_SECRET")
+	util.Response(c, "balance reconciled", 200, models.NewReconciliationResponses(reconciliation), nil)
+}
+
+// SetAdminRole changes the role of another admin
+func (u *HTTPHandler) SetAdminRole(c *gin.Context) {
+	roleRequest := &models.AdminRoleRequest{}
+	if !bindRequest(c, roleRequest) {
+		return
+	}
 
-	accessToken, err := middleware.GenerateToken(jwt.SigningMethodHS256, accessClaims, &secret)
+	admin, err := u.GetAdminFromContext(c)
 	if err != nil {
-		util.Response(c, "error generating access token", 500, "error generating access token", nil)
+		apperror.Respond(c, err)
 		return
 	}
-	refreshToken, err := middleware.GenerateToken(jwt.SigningMethodHS256, refreshClaims, &secret)
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
 	if err != nil {
-		util.Response(c, "error generating refresh token", 500, "error generating refresh token", nil)
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "invalid admin id"))
 		return
 	}
-	c.Header("access_token", *accessToken)
-	c.Header("refresh_token", *refreshToken)
 
-	util.Response(c, "login successful", http.StatusOK, gin.H{
-		"admin":         admin,
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	}, nil)
+	if uint(id) == admin.ID {
+		apperror.Respond(c, apperror.New(apperror.CodeForbidden, "you cannot change your own role"))
+		return
+	}
+
+	updated, err := u.Repository.SetAdminRole(uint(id), roleRequest.Role)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	util.Response(c, "role updated", 200, models.NewAdminResponse(updated), nil)
 }
@@ -0,0 +1,38 @@
+package api
+
+import "log"
+
+const (
+	// backgroundWorkers run the jobs handlers hand off, such as sending password resets
+	backgroundWorkers = 4
+	// backgroundQueueSize jobs can wait for a worker, more are dropped
+	backgroundQueueSize = 256
+)
+
+// background runs jobs off the request path on a fixed number of workers, so a burst of requests
+// cannot start an unbounded number of goroutines
+type background struct {
+	jobs chan func()
+}
+
+// newBackground starts workers that run the jobs of a queue of size
+func newBackground(workers int, size int) *background {
+	b := &background{jobs: make(chan func(), size)}
+	for i := 0; i < workers; i++ {
+		go func() {
+			for job := range b.jobs {
+				job()
+			}
+		}()
+	}
+	return b
+}
+
+// run queues job for a worker. It is dropped and logged as name when the queue is full.
+func (b *background) run(name string, job func()) {
+	select {
+	case b.jobs <- job:
+	default:
+		log.Printf("background queue is full, dropped %s\n", name)
+	}
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"sync"
+	"testing"
+)
+
+func TestBackgroundRunsQueuedJobs(t *testing.T) {
+	b := newBackground(2, 4)
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	ran := 0
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		b.run("test job", func() {
+			defer wg.Done()
+			mu.Lock()
+			ran++
+			mu.Unlock()
+		})
+	}
+	wg.Wait()
+	if ran != 3 {
+		t.Errorf("%d jobs ran, want 3", ran)
+	}
+}
+
+func TestBackgroundDropsJobsWhenFull(t *testing.T) {
+	// without workers nothing leaves the queue
+	b := newBackground(0, 2)
+	for i := 0; i < 5; i++ {
+		b.run("test job", func() {})
+	}
+	if queued := len(b.jobs); queued != 2 {
+		t.Errorf("%d jobs queued, want 2", queued)
+	}
+}
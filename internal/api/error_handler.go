@@ -0,0 +1,14 @@
+package api
+
+import (
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ErrorCatalogue lists every error code the API answers with, its status and what it means
+func (u *HTTPHandler) ErrorCatalogue(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	util.Response(c, "error codes", 200, apperror.Catalogue(), nil)
+}
@@ -0,0 +1,146 @@
+package api
+
+import (
+	"errors"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSpreadBps keeps the spread below the rate itself
+const maxSpreadBps = 10000
+
+// SetExchangeRate creates or replaces the rate of a currency pair
+func (u *HTTPHandler) SetExchangeRate(c *gin.Context) {
+	rateRequest := &models.ExchangeRateRequest{}
+	if !bindRequest(c, rateRequest) {
+		return
+	}
+
+	spreadBps := u.Config.FXSpreadBps
+	if rateRequest.SpreadBps != nil {
+		spreadBps = *rateRequest.SpreadBps
+	}
+	if spreadBps < 0 || spreadBps >= maxSpreadBps {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "spread must be between 0 and 9999 basis points"))
+		return
+	}
+
+	//a pair is stored one way round only
+	existing, err := u.Repository.FindExchangeRate(rateRequest.BaseCurrency, rateRequest.QuoteCurrency)
+	if err == nil && existing.BaseCurrency != rateRequest.BaseCurrency {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest,
+			"set the rate as "+existing.BaseCurrency+"/"+existing.QuoteCurrency))
+		return
+	}
+
+	rate := &models.ExchangeRate{
+		BaseCurrency:  rateRequest.BaseCurrency,
+		QuoteCurrency: rateRequest.QuoteCurrency,
+		Rate:          rateRequest.Rate,
+		SpreadBps:     spreadBps,
+	}
+	if err := u.Repository.SaveExchangeRate(rate); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "rate not saved"))
+		return
+	}
+
+	util.Response(c, "rate saved", 200, models.NewExchangeRateResponse(rate), nil)
+}
+
+// ExchangeRates lists the rates of all currency pairs
+func (u *HTTPHandler) ExchangeRates(c *gin.Context) {
+	rates, err := u.Repository.ExchangeRates()
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not retrieve rates"))
+		return
+	}
+	util.Response(c, "rates successfully retrieved", 200, models.NewExchangeRateResponses(rates), nil)
+}
+
+// FXQuote quotes a conversion between two currencies at a rate locked for the quote's lifetime
+func (u *HTTPHandler) FXQuote(c *gin.Context) {
+	quoteRequest := &models.FXQuoteRequest{}
+	if !bindRequest(c, quoteRequest) {
+		return
+	}
+
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	sellAmount, err := models.ParseMoney(quoteRequest.Amount, quoteRequest.FromCurrency)
+	if err != nil {
+		invalidAmount(c, err)
+		return
+	}
+
+	exchangeRate, err := u.Repository.FindExchangeRate(quoteRequest.FromCurrency, quoteRequest.ToCurrency)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	midRate, customerRate, err := exchangeRate.CustomerRate(quoteRequest.FromCurrency, quoteRequest.ToCurrency)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not quote"))
+		return
+	}
+
+	buyAmount, err := models.Convert(sellAmount, customerRate, quoteRequest.ToCurrency)
+	if err != nil || buyAmount.Minor <= 0 {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "amount too small to convert"))
+		return
+	}
+
+	quote := &models.FXQuote{
+		UserID:     user.ID,
+		SellAmount: sellAmount,
+		BuyAmount:  buyAmount,
+		MidRate:    models.FormatRate(midRate),
+		Rate:       models.FormatRate(customerRate),
+		SpreadBps:  exchangeRate.SpreadBps,
+		ExpiresAt:  time.Now().Add(u.Config.FXQuoteTTL),
+	}
+	if err := u.Repository.CreateFXQuote(quote); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not quote"))
+		return
+	}
+
+	util.Response(c, "quote created", 200, models.NewFXQuoteResponse(quote), nil)
+}
+
+// FXConvert converts between the user's wallets at the rate of a quote
+func (u *HTTPHandler) FXConvert(c *gin.Context) {
+	convertRequest := &models.FXConvertRequest{}
+	if !bindRequest(c, convertRequest) {
+		return
+	}
+
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if !u.authorizePIN(c, user, convertRequest.PIN) {
+		return
+	}
+
+	transactions, err := u.Repository.ExecuteFXQuote(user, convertRequest.QuoteID)
+	switch {
+	case errors.Is(err, ports.ErrWalletNotFound):
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeWalletNotFound, "you do not hold a wallet in this currency"))
+	case err != nil:
+		// quote and funds errors carry their own codes
+		apperror.Respond(c, apperror.Unexpected(err, "conversion failed"))
+	default:
+		util.Response(c, "conversion successful", 200, models.NewTransactionResponses(transactions), nil)
+	}
+}
@@ -0,0 +1,132 @@
+package api
+
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/util"
+	"payment-system-one/internal/validation"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// dashboardTransactions is how many recent transactions the dashboard shows
+const dashboardTransactions = 10
+
+// transactionStatuses are the statuses history can be filtered by
+var transactionStatuses = map[string]bool{
+	models.TransactionPending:   true,
+	models.TransactionCompleted: true,
+	models.TransactionFailed:    true,
+	models.TransactionReversed:  true,
+}
+
+// parseHistoryDate reads a date as 2006-01-02 or RFC 3339. A bare end date includes the whole day.
+func parseHistoryDate(value string, end bool) (time.Time, error) {
+	if date, err := time.Parse("2006-01-02", value); err == nil {
+		if end {
+			date = date.AddDate(0, 0, 1)
+		}
+		return date, nil
+	}
+	return time.Parse(time.RFC3339, value)
+}
+
+// transactionFilterFromQuery reads the history filters from the query string:
+// from, to, direction, currency, min_amount, max_amount, counterparty, status, sort, cursor and limit.
+// Every invalid parameter is reported with the validation code for it.
+func transactionFilterFromQuery(c *gin.Context, accountNo int) (models.TransactionFilter, []util.ErrorDetail) {
+	filter := models.TransactionFilter{AccountNo: accountNo}
+	errs := []util.ErrorDetail{}
+
+	if from := c.Query("from"); from != "" {
+		date, err := parseHistoryDate(from, false)
+		if err != nil {
+			errs = append(errs, queryError("from", validation.CodeInvalid, "from must be a date such as 2024-01-31"))
+		}
+		filter.From = date
+	}
+	if to := c.Query("to"); to != "" {
+		date, err := parseHistoryDate(to, true)
+		if err != nil {
+			errs = append(errs, queryError("to", validation.CodeInvalid, "to must be a date such as 2024-01-31"))
+		}
+		filter.To = date
+	}
+
+	switch direction := c.Query("direction"); direction {
+	case "", models.DirectionIncoming, models.DirectionOutgoing:
+		filter.Direction = direction
+	default:
+		errs = append(errs, queryError("direction", validation.CodeInvalid, "direction must be incoming or outgoing"))
+	}
+
+	filter.Currency = c.Query("currency")
+	if filter.Currency != "" && !models.IsSupportedCurrency(filter.Currency) {
+		errs = append(errs, queryError("currency", validation.CodeUnsupportedCurrency, "currency is not supported"))
+	}
+	amountCurrency := filter.Currency
+	if amountCurrency == "" {
+		amountCurrency = models.DefaultCurrency
+	}
+	for _, bound := range []struct {
+		name  string
+		value **int64
+	}{{"min_amount", &filter.MinAmount}, {"max_amount", &filter.MaxAmount}} {
+		if value := c.Query(bound.name); value != "" {
+			amount, err := models.ParseMoney(value, amountCurrency)
+			if err != nil {
+				errs = append(errs, queryError(bound.name, validation.CodeInvalidAmount, bound.name+" must be a decimal amount"))
+				continue
+			}
+			// amounts only compare within one currency
+			filter.Currency = amountCurrency
+			*bound.value = &amount.Minor
+		}
+	}
+
+	if counterparty := c.Query("counterparty"); counterparty != "" {
+		accountNo, err := strconv.Atoi(counterparty)
+		if err != nil {
+			errs = append(errs, queryError("counterparty", validation.CodeNotNumeric, "counterparty must be an account number"))
+		}
+		filter.Counterparty = accountNo
+	}
+
+	filter.Status = c.Query("status")
+	if filter.Status != "" && !transactionStatuses[filter.Status] {
+		errs = append(errs, queryError("status", validation.CodeInvalid, "status must be pending, completed, failed or reversed"))
+	}
+
+	switch sort := c.DefaultQuery("sort", "desc"); sort {
+	case "asc":
+		filter.Ascending = true
+	case "desc":
+	default:
+		errs = append(errs, queryError("sort", validation.CodeInvalid, "sort must be asc or desc"))
+	}
+
+	if cursor := c.Query("cursor"); cursor != "" {
+		decoded, err := models.DecodeTransactionCursor(cursor)
+		if err != nil {
+			errs = append(errs, queryError("cursor", validation.CodeInvalid, "cursor is invalid"))
+		}
+		filter.Cursor = decoded
+	}
+
+	filter.Limit = models.DefaultHistoryLimit
+	if limit := c.Query("limit"); limit != "" {
+		parsed, err := strconv.Atoi(limit)
+		if err != nil || parsed < 1 || parsed > models.MaxHistoryLimit {
+			errs = append(errs, queryError("limit", validation.CodeInvalid, "limit must be between 1 and "+strconv.Itoa(models.MaxHistoryLimit)))
+		}
+		filter.Limit = parsed
+	}
+
+	return filter, errs
+}
+
+// queryError reports an invalid query parameter
+func queryError(field, code, message string) util.ErrorDetail {
+	return util.ErrorDetail{Field: field, Code: code, Message: message}
+}
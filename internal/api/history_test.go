@@ -0,0 +1,75 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/validation"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+// filterFromQuery runs transactionFilterFromQuery on a request with the query string
+func filterFromQuery(t *testing.T, query string) (models.TransactionFilter, map[string]string) {
+	t.Helper()
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/user/transactions?"+query, nil)
+	filter, errs := transactionFilterFromQuery(c, 1001)
+	codes := map[string]string{}
+	for _, detail := range errs {
+		codes[detail.Field] = detail.Code
+	}
+	return filter, codes
+}
+
+func TestTransactionFilterFromQuery(t *testing.T) {
+	cursor := (&models.TransactionCursor{ID: 7}).Encode()
+	filter, codes := filterFromQuery(t, "direction=incoming&currency=USD&min_amount=10.50&max_amount=20"+
+		"&counterparty=2002&status=failed&sort=asc&limit=5&cursor="+cursor)
+	if len(codes) != 0 {
+		t.Fatalf("valid query reported %v", codes)
+	}
+	if filter.AccountNo != 1001 || filter.Direction != models.DirectionIncoming || filter.Currency != "USD" ||
+		filter.Counterparty != 2002 || filter.Status != models.TransactionFailed || !filter.Ascending || filter.Limit != 5 {
+		t.Errorf("unexpected filter %+v", filter)
+	}
+	if filter.MinAmount == nil || *filter.MinAmount != 1050 || filter.MaxAmount == nil || *filter.MaxAmount != 2000 {
+		t.Errorf("amounts are %v and %v, want 1050 and 2000", filter.MinAmount, filter.MaxAmount)
+	}
+	if filter.Cursor == nil || filter.Cursor.ID != 7 {
+		t.Errorf("cursor is %+v, want id 7", filter.Cursor)
+	}
+
+	filter, codes = filterFromQuery(t, "")
+	if len(codes) != 0 || filter.Ascending || filter.Limit != models.DefaultHistoryLimit {
+		t.Errorf("defaults are ascending %v and limit %d with errors %v", filter.Ascending, filter.Limit, codes)
+	}
+}
+
+func TestTransactionFilterFromQueryRejectsInvalid(t *testing.T) {
+	tests := []struct {
+		query string
+		field string
+		code  string
+	}{
+		{"limit=0", "limit", validation.CodeInvalid},
+		{"limit=101", "limit", validation.CodeInvalid},
+		{"limit=ten", "limit", validation.CodeInvalid},
+		{"sort=newest", "sort", validation.CodeInvalid},
+		{"status=settled", "status", validation.CodeInvalid},
+		{"min_amount=ten", "min_amount", validation.CodeInvalidAmount},
+		{"max_amount=1.234", "max_amount", validation.CodeInvalidAmount},
+		{"direction=sideways", "direction", validation.CodeInvalid},
+		{"currency=XYZ", "currency", validation.CodeUnsupportedCurrency},
+		{"counterparty=abc", "counterparty", validation.CodeNotNumeric},
+		{"from=yesterday", "from", validation.CodeInvalid},
+		{"cursor=not-a-cursor", "cursor", validation.CodeInvalid},
+	}
+	for _, test := range tests {
+		_, codes := filterFromQuery(t, test.query)
+		if codes[test.field] != test.code {
+			t.Errorf("%s: %s reported %q, want %q", test.query, test.field, codes[test.field], test.code)
+		}
+	}
+}
@@ -3,32 +3,103 @@ package api
 import (
 	"fmt"
 	"github.com/gin-gonic/gin"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/middleware"
 	"payment-system-one/internal/models"
 	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"payment-system-one/internal/validation"
+	"time"
 )
 
 type HTTPHandler struct {
 	Repository ports.Repository
+	Notifier   ports.Notifier
+	SMS        ports.SMSSender
+	Config     Config
+	background *background
 }
 
-func NewHTTPHandler(repository ports.Repository) *HTTPHandler {
+// Config holds the settings handlers need besides the repository
+type Config struct {
+	// TransferFee is the flat fee charged to the payer on every transfer in its currency
+	TransferFee models.Money
+	// FXQuoteTTL is how long a quoted exchange rate is honoured
+	FXQuoteTTL time.Duration
+	// FXSpreadBps is the default markup, in basis points, on exchange rates that do not set their own
+	FXSpreadBps int64
+	// ReversalAllowNegative lets reversals overdraw a recipient that has spent the money, unless a request says otherwise
+	ReversalAllowNegative bool
+	// AdminInvitationTTL is how long an admin invitation can be used
+	AdminInvitationTTL time.Duration
+	// Keys sign and verify tokens
+	Keys *middleware.KeySet
+	// TOTPIssuer names the service in authenticator apps
+	TOTPIssuer string
+	// PINMaxAttempts wrong transaction PINs in a row lock PIN use for PINLockout
+	PINMaxAttempts int
+	PINLockout     time.Duration
+	// LoginMaxFailures failed logins of an account, or LoginIPMaxFailures from an IP address, within
+	// LoginLockout lock logins out for LoginLockout
+	LoginMaxFailures   int
+	LoginIPMaxFailures int
+	LoginLockout       time.Duration
+	// PasswordResetTTL is how long a password reset token can be used
+	PasswordResetTTL time.Duration
+	// PasswordResetURL is the page reset tokens are linked to, the bare token is sent if empty
+	PasswordResetURL string
+	// PasswordResetInterval is how long an email, or a client IP, waits before asking for another reset
+	PasswordResetInterval time.Duration
+	// EmailVerificationTTL is how long an email verification token can be used
+	EmailVerificationTTL time.Duration
+	// EmailVerificationURL is the page verification tokens are linked to, the bare token is sent if empty
+	EmailVerificationURL string
+	// EmailVerificationResendInterval is how long a user waits before asking for another verification
+	EmailVerificationResendInterval time.Duration
+	// DefaultPhoneCountryCode is the country code, digits only, given to national phone numbers
+	DefaultPhoneCountryCode string
+	// PhoneOTPTTL is how long a phone verification code can be used
+	PhoneOTPTTL time.Duration
+	// PhoneOTPMaxAttempts wrong codes use up a phone verification code
+	PhoneOTPMaxAttempts int
+	// PhoneOTPResendInterval is how long a user waits before asking for another code
+	PhoneOTPResendInterval time.Duration
+}
+
+func NewHTTPHandler(repository ports.Repository, notifier ports.Notifier, sms ports.SMSSender, config Config) *HTTPHandler {
 	return &HTTPHandler{
 		Repository: repository,
+		Notifier:   notifier,
+		SMS:        sms,
+		Config:     config,
+		background: newBackground(backgroundWorkers, backgroundQueueSize),
 	}
 }
 
 func (u *HTTPHandler) GetUserFromContext(c *gin.Context) (*models.User, error) {
 	contextUser, exists := c.Get("user")
 	if !exists {
-		return nil, fmt.Errorf("error getting user from context")
+		return nil, apperror.Wrap(fmt.Errorf("error getting user from context"), apperror.CodeUnauthenticated, "user not logged in")
 	}
 	user, ok := contextUser.(*models.User)
 	if !ok {
-		return nil, fmt.Errorf("an error occurred")
+		return nil, apperror.Wrap(fmt.Errorf("an error occurred"), apperror.CodeUnauthenticated, "user not logged in")
 	}
 	return user, nil
 }
 
+func (u *HTTPHandler) GetAdminFromContext(c *gin.Context) (*models.Admin, error) {
+	contextAdmin, exists := c.Get("admin")
+	if !exists {
+		return nil, apperror.Wrap(fmt.Errorf("error getting admin from context"), apperror.CodeUnauthenticated, "admin not logged in")
+	}
+	admin, ok := contextAdmin.(*models.Admin)
+	if !ok {
+		return nil, apperror.Wrap(fmt.Errorf("an error occurred"), apperror.CodeUnauthenticated, "admin not logged in")
+	}
+	return admin, nil
+}
+
 func (u *HTTPHandler) GetTokenFromContext(c *gin.Context) (string, error) {
 	tokenI, exists := c.Get("access_token")
 	if !exists {
@@ -37,3 +108,48 @@ func (u *HTTPHandler) GetTokenFromContext(c *gin.Context) (string, error) {
 	tokenstr := tokenI.(string)
 	return tokenstr, nil
 }
+
+// transferFee returns the fee charged on a transfer in currency
+func (u *HTTPHandler) transferFee(currency string) models.Money {
+	if u.Config.TransferFee.Currency != currency {
+		return models.NewMoney(0, currency)
+	}
+	return u.Config.TransferFee
+}
+
+// GetTokenIDFromContext returns the id (jti) and expiry of the request's access token
+func (u *HTTPHandler) GetTokenIDFromContext(c *gin.Context) (string, time.Time, error) {
+	tokenID, ok := c.Get("access_token_id")
+	if !ok {
+		return "", time.Time{}, apperror.Wrap(fmt.Errorf("error getting access token id"), apperror.CodeUnauthenticated, "not logged in")
+	}
+	expiresAt, ok := c.Get("access_token_expires_at")
+	if !ok {
+		return "", time.Time{}, apperror.Wrap(fmt.Errorf("error getting access token expiry"), apperror.CodeUnauthenticated, "not logged in")
+	}
+	return tokenID.(string), expiresAt.(time.Time), nil
+}
+
+// bindRequest binds the request body into request, a pointer to a request model, and checks its
+// binding rules. An invalid request is answered with every failing field and false is returned.
+func bindRequest(c *gin.Context, request interface{}) bool {
+	if err := c.ShouldBind(request); err != nil {
+		util.DetailedResponse(c, "invalid request", 400, nil, validation.Errors(err))
+		return false
+	}
+	return true
+}
+
+// invalidAmount answers a request whose amount has more decimal places than its currency
+func invalidAmount(c *gin.Context, err error) {
+	invalidField(c, "amount", validation.CodeInvalidAmount, err.Error())
+}
+
+// invalidField answers a request with one field that fails a check the binding tags cannot make
+func invalidField(c *gin.Context, field string, code string, message string) {
+	util.DetailedResponse(c, "invalid request", 400, nil, []util.ErrorDetail{{
+		Field:   field,
+		Code:    code,
+		Message: message,
+	}})
+}
@@ -0,0 +1,417 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/middleware"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// mfaSubject is the user or admin going through two-factor authentication
+type mfaSubject struct {
+	audience string
+	id       uint
+	email    string
+	totp     models.TOTP
+}
+
+// findMFASubject loads the two-factor state of the user or admin id
+func (u *HTTPHandler) findMFASubject(audience string, id uint) (*mfaSubject, error) {
+	if audience == models.AudienceAdmin {
+		admin, err := u.Repository.FindAdminByID(id)
+		if err != nil {
+			return nil, err
+		}
+		return &mfaSubject{audience: audience, id: admin.ID, email: admin.Email, totp: admin.TOTP}, nil
+	}
+	user, err := u.Repository.FindUserByID(id)
+	if err != nil {
+		return nil, err
+	}
+	return &mfaSubject{audience: models.AudienceUser, id: user.ID, email: user.Email, totp: user.TOTP}, nil
+}
+
+// subjectFromContext returns the logged in admin or user
+func (u *HTTPHandler) subjectFromContext(c *gin.Context) (*mfaSubject, error) {
+	if admin, err := u.GetAdminFromContext(c); err == nil {
+		return &mfaSubject{audience: models.AudienceAdmin, id: admin.ID, email: admin.Email, totp: admin.TOTP}, nil
+	}
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		return nil, err
+	}
+	return &mfaSubject{audience: models.AudienceUser, id: user.ID, email: user.Email, totp: user.TOTP}, nil
+}
+
+// requireSecondFactor answers a login whose password was right with a short-lived MFA-pending
+// token instead of a session. enrol tells the client an authenticator must be enrolled first.
+func (u *HTTPHandler) requireSecondFactor(c *gin.Context, audience string, subjectID uint, enrol bool) {
+	tokenID, err := util.GenerateTokenID()
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "error generating mfa token"))
+		return
+	}
+	mfaToken, err := middleware.GenerateToken(u.Config.Keys, middleware.GenerateMFAClaims(tokenID, audience, subjectID))
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "error generating mfa token"))
+		return
+	}
+
+	util.Response(c, "two-factor authentication required", http.StatusOK, gin.H{
+		"mfa_required":           true,
+		"mfa_enrolment_required": enrol,
+		"mfa_token":              mfaToken,
+	}, nil)
+}
+
+// mfaSubjectFromToken verifies an MFA-pending token that has not been used yet and loads its subject.
+// A token that is invalid, used or of a missing account is an INVALID_TOKEN error.
+func (u *HTTPHandler) mfaSubjectFromToken(token string) (*mfaSubject, string, time.Time, error) {
+	_, claims, err := middleware.AuthorizeToken(&token, u.Config.Keys, middleware.AudienceMFA)
+	if err != nil {
+		return nil, "", time.Time{}, apperror.Wrap(err, apperror.CodeInvalidToken, "invalid mfa token")
+	}
+	tokenID, _ := claims["jti"].(string)
+	if tokenID == "" {
+		return nil, "", time.Time{}, apperror.New(apperror.CodeInvalidToken, "invalid mfa token")
+	}
+	used, err := u.Repository.TokenInBlacklist(tokenID)
+	if err != nil {
+		return nil, "", time.Time{}, apperror.Unexpected(err, "could not check mfa token")
+	}
+	if used {
+		return nil, "", time.Time{}, apperror.New(apperror.CodeInvalidToken, "mfa token has been used")
+	}
+	subject, _ := claims.GetSubject()
+	id, err := strconv.ParseUint(subject, 10, 64)
+	if err != nil {
+		return nil, "", time.Time{}, apperror.Wrap(err, apperror.CodeInvalidToken, "invalid mfa token")
+	}
+	audience, _ := claims["subject_type"].(string)
+	expiresAt, _ := claims.GetExpirationTime()
+
+	found, err := u.findMFASubject(audience, uint(id))
+	if errors.Is(err, ports.ErrUserNotFound) || errors.Is(err, ports.ErrAdminNotFound) {
+		return nil, "", time.Time{}, apperror.Wrap(err, apperror.CodeInvalidToken, "invalid mfa token")
+	}
+	if err != nil {
+		return nil, "", time.Time{}, apperror.Unexpected(err, "could not load account")
+	}
+	return found, tokenID, expiresAt.Time, nil
+}
+
+// verifySecondFactor checks a TOTP code, or a recovery code if allowRecovery, and uses it up
+func (u *HTTPHandler) verifySecondFactor(subject *mfaSubject, code string, allowRecovery bool) (bool, error) {
+	if subject.totp.TOTPSecret == "" {
+		return false, nil
+	}
+	if step, ok := util.VerifyTOTP(subject.totp.TOTPSecret, code, time.Now(), subject.totp.TOTPLastStep); ok {
+		err := u.Repository.AcceptTOTPStep(subject.audience, subject.id, step)
+		if errors.Is(err, ports.ErrTOTPCodeUsed) {
+			return false, nil
+		}
+		if err != nil {
+			return false, err
+		}
+		subject.totp.TOTPLastStep = step
+		return true, nil
+	}
+	if !allowRecovery || !subject.totp.TOTPEnabled {
+		return false, nil
+	}
+
+	err := u.Repository.UseRecoveryCode(subject.audience, subject.id, util.HashToken(code))
+	if errors.Is(err, ports.ErrRecoveryCodeInvalid) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// enrolTOTP gives a subject a new, not yet confirmed, TOTP secret
+func (u *HTTPHandler) enrolTOTP(subject *mfaSubject) (*models.TOTPEnrolment, error) {
+	secret, err := util.GenerateTOTPSecret()
+	if err != nil {
+		return nil, err
+	}
+	if err := u.Repository.SetTOTP(subject.audience, subject.id, models.TOTP{TOTPSecret: secret}); err != nil {
+		return nil, err
+	}
+	return &models.TOTPEnrolment{
+		Secret: secret,
+		URI:    util.TOTPURI(u.Config.TOTPIssuer, subject.email, secret),
+	}, nil
+}
+
+// issueRecoveryCodes replaces the subject's recovery codes, returning the new codes in clear
+// text; only their hashes are stored, so they cannot be shown again
+func (u *HTTPHandler) issueRecoveryCodes(subject *mfaSubject) ([]string, error) {
+	codes, err := util.GenerateRecoveryCodes(models.RecoveryCodeCount)
+	if err != nil {
+		return nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = util.HashToken(code)
+	}
+	if err := u.Repository.ReplaceRecoveryCodes(subject.audience, subject.id, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// enableTOTP turns on two-factor authentication once a code has confirmed the enrolled secret
+func (u *HTTPHandler) enableTOTP(subject *mfaSubject) ([]string, error) {
+	codes, err := u.issueRecoveryCodes(subject)
+	if err != nil {
+		return nil, err
+	}
+	subject.totp.TOTPEnabled = true
+	if err := u.Repository.SetTOTP(subject.audience, subject.id, subject.totp); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// EnrolMFA starts the mandatory authenticator enrolment of an admin logging in, with the MFA-pending token
+func (u *HTTPHandler) EnrolMFA(c *gin.Context) {
+	enrolRequest := &models.MFAEnrolRequest{}
+	if !bindRequest(c, enrolRequest) {
+		return
+	}
+
+	subject, _, _, err := u.mfaSubjectFromToken(enrolRequest.MFAToken)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if subject.totp.TOTPEnabled {
+		apperror.Respond(c, apperror.New(apperror.CodeMFAAlreadyEnabled, "two-factor authentication is already enabled"))
+		return
+	}
+
+	enrolment, err := u.enrolTOTP(subject)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not enrol authenticator"))
+		return
+	}
+	util.Response(c, "scan the otpauth uri with an authenticator app and verify a code", 200, enrolment, nil)
+}
+
+// VerifyMFA completes a login with the MFA-pending token and a TOTP or recovery code. An admin
+// confirming a first enrolment gets their recovery codes along with the session.
+func (u *HTTPHandler) VerifyMFA(c *gin.Context) {
+	verifyRequest := &models.MFALoginRequest{}
+	if !bindRequest(c, verifyRequest) {
+		return
+	}
+
+	subject, tokenID, expiresAt, err := u.mfaSubjectFromToken(verifyRequest.MFAToken)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	// wrong codes count as failed logins of the account, so they are throttled the same way
+	accountKey := loginAccountKey(subject.audience, subject.email)
+	if !u.reserveLoginAttempt(c, accountKey) {
+		return
+	}
+
+	ok, err := u.verifySecondFactor(subject, verifyRequest.Code, true)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not verify code"))
+		return
+	}
+	if !ok {
+		apperror.Respond(c, apperror.New(apperror.CodeInvalidCredentials, "invalid two-factor code"))
+		return
+	}
+	if !u.releaseLoginAttempt(c, accountKey) {
+		return
+	}
+
+	// the mfa token cannot complete a second login
+	if err := u.Repository.BlacklistToken(tokenID, expiresAt); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not verify code"))
+		return
+	}
+
+	var recoveryCodes []string
+	if !subject.totp.TOTPEnabled {
+		recoveryCodes, err = u.enableTOTP(subject)
+		if err != nil {
+			apperror.Respond(c, apperror.Unexpected(err, "could not enable two-factor authentication"))
+			return
+		}
+	}
+
+	accessToken, refreshToken, err := u.startSession(subject.email, subject.audience, subject.id)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "error generating tokens"))
+		return
+	}
+	c.Header("access_token", *accessToken)
+	c.Header("refresh_token", *refreshToken)
+
+	data := gin.H{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	}
+	if recoveryCodes != nil {
+		data["recovery_codes"] = recoveryCodes
+	}
+	util.Response(c, "login successful", http.StatusOK, data, nil)
+}
+
+// EnrolTOTP gives the logged in user a new authenticator secret, which is enforced once confirmed
+func (u *HTTPHandler) EnrolTOTP(c *gin.Context) {
+	subject, err := u.subjectFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if subject.totp.TOTPEnabled {
+		apperror.Respond(c, apperror.New(apperror.CodeMFAAlreadyEnabled, "two-factor authentication is already enabled"))
+		return
+	}
+
+	enrolment, err := u.enrolTOTP(subject)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not enrol authenticator"))
+		return
+	}
+	util.Response(c, "scan the otpauth uri with an authenticator app and confirm a code", 200, enrolment, nil)
+}
+
+// ConfirmTOTP enables two-factor authentication with a code from the enrolled authenticator and
+// returns the recovery codes
+func (u *HTTPHandler) ConfirmTOTP(c *gin.Context) {
+	codeRequest := &models.MFACodeRequest{}
+	if !bindRequest(c, codeRequest) {
+		return
+	}
+
+	subject, err := u.subjectFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if subject.totp.TOTPEnabled {
+		apperror.Respond(c, apperror.New(apperror.CodeMFAAlreadyEnabled, "two-factor authentication is already enabled"))
+		return
+	}
+
+	ok, err := u.verifySecondFactor(subject, codeRequest.Code, false)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not verify code"))
+		return
+	}
+	if !ok {
+		apperror.Respond(c, apperror.New(apperror.CodeWrongMFACode, "invalid two-factor code"))
+		return
+	}
+
+	recoveryCodes, err := u.enableTOTP(subject)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not enable two-factor authentication"))
+		return
+	}
+	util.Response(c, "two-factor authentication enabled", 200, gin.H{"recovery_codes": recoveryCodes}, nil)
+}
+
+// DisableTOTP turns off the logged in user's two-factor authentication, with a current code
+func (u *HTTPHandler) DisableTOTP(c *gin.Context) {
+	codeRequest := &models.MFACodeRequest{}
+	if !bindRequest(c, codeRequest) {
+		return
+	}
+
+	subject, err := u.subjectFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if !subject.totp.TOTPEnabled {
+		apperror.Respond(c, apperror.New(apperror.CodeMFANotEnabled, "two-factor authentication is not enabled"))
+		return
+	}
+
+	ok, err := u.verifySecondFactor(subject, codeRequest.Code, true)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not verify code"))
+		return
+	}
+	if !ok {
+		apperror.Respond(c, apperror.New(apperror.CodeWrongMFACode, "invalid two-factor code"))
+		return
+	}
+
+	if err := u.Repository.ResetTOTP(subject.audience, subject.id); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not disable two-factor authentication"))
+		return
+	}
+	util.Response(c, "two-factor authentication disabled", 200, "success", nil)
+}
+
+// RegenerateRecoveryCodes replaces the logged in user's or admin's recovery codes, with a current code
+func (u *HTTPHandler) RegenerateRecoveryCodes(c *gin.Context) {
+	codeRequest := &models.MFACodeRequest{}
+	if !bindRequest(c, codeRequest) {
+		return
+	}
+
+	subject, err := u.subjectFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+	if !subject.totp.TOTPEnabled {
+		apperror.Respond(c, apperror.New(apperror.CodeMFANotEnabled, "two-factor authentication is not enabled"))
+		return
+	}
+
+	ok, err := u.verifySecondFactor(subject, codeRequest.Code, false)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not verify code"))
+		return
+	}
+	if !ok {
+		apperror.Respond(c, apperror.New(apperror.CodeWrongMFACode, "invalid two-factor code"))
+		return
+	}
+
+	recoveryCodes, err := u.issueRecoveryCodes(subject)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not generate recovery codes"))
+		return
+	}
+	util.Response(c, "recovery codes generated", 200, gin.H{"recovery_codes": recoveryCodes}, nil)
+}
+
+// ResetUserTOTP lets an admin turn off the two-factor authentication of a user who lost both
+// their authenticator and their recovery codes
+func (u *HTTPHandler) ResetUserTOTP(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "invalid user id"))
+		return
+	}
+
+	err = u.Repository.ResetTOTP(models.AudienceUser, uint(id))
+	if errors.Is(err, ports.ErrAccountNotFound) {
+		apperror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not reset two-factor authentication"))
+		return
+	}
+	util.Response(c, "two-factor authentication reset", 200, "success", nil)
+}
@@ -0,0 +1,185 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ForgotPassword sends a single-use password reset token to the email if it has an account. An
+// email, and a client IP, can ask at most once per PasswordResetInterval. The token is sent by a
+// background worker and failures are only logged, so the answer is the same, in the same time,
+// whether or not the account exists.
+func (u *HTTPHandler) ForgotPassword(c *gin.Context) {
+	forgotRequest := &models.ForgotPasswordRequest{}
+	if !bindRequest(c, forgotRequest) {
+		return
+	}
+
+	email := strings.ToLower(strings.TrimSpace(forgotRequest.Email))
+	for _, key := range []string{models.PasswordResetIPKey(c.ClientIP()), models.PasswordResetEmailKey(email)} {
+		next, err := u.Repository.ReserveSend(key, u.Config.PasswordResetInterval)
+		if errors.Is(err, ports.ErrSendThrottled) {
+			retryAfter := time.Until(next).Round(time.Second) + time.Second
+			c.Header("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+			apperror.Respond(c, apperror.New(apperror.CodeRateLimited,
+				"a password reset was asked for recently, try again in "+retryAfter.String()))
+			return
+		}
+		if err != nil {
+			apperror.Respond(c, apperror.Unexpected(err, "could not send password reset"))
+			return
+		}
+	}
+
+	u.background.run("password reset", func() {
+		if err := u.sendPasswordReset(forgotRequest.Email); err != nil {
+			log.Printf("send password reset errors: %v\n", err)
+		}
+	})
+
+	util.Response(c, "if the email has an account, a password reset token has been sent to it", 200, "success", nil)
+}
+
+// sendPasswordReset stores the hash of a new reset token and sends the token to the user with
+// email, if there is one
+func (u *HTTPHandler) sendPasswordReset(email string) error {
+	user, err := u.Repository.FindUserByEmail(email)
+	if errors.Is(err, ports.ErrUserNotFound) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	token, err := util.GenerateTokenID()
+	if err != nil {
+		return err
+	}
+
+	reset := &models.PasswordReset{
+		UserID:    user.ID,
+		TokenHash: util.HashToken(token),
+		ExpiresAt: time.Now().Add(u.Config.PasswordResetTTL),
+	}
+	if err := u.Repository.CreatePasswordReset(reset); err != nil {
+		return err
+	}
+
+	body := "Use this token to reset your password: " + token
+	if u.Config.PasswordResetURL != "" {
+		body = "Reset your password at " + u.Config.PasswordResetURL + "?token=" + url.QueryEscape(token)
+	}
+	body += "\nIt expires in " + u.Config.PasswordResetTTL.String() + ". If you did not ask for it, ignore this message."
+
+	return u.Notifier.Notify(models.Notification{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body:    body,
+	})
+}
+
+// ResetPassword sets a new password with a reset token and logs the user out everywhere
+func (u *HTTPHandler) ResetPassword(c *gin.Context) {
+	resetRequest := &models.ResetPasswordRequest{}
+	if !bindRequest(c, resetRequest) {
+		return
+	}
+
+	hashPass, err := util.HashPassword(resetRequest.Password)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not hash password"))
+		return
+	}
+
+	user, err := u.Repository.ResetPassword(util.HashToken(resetRequest.Token), hashPass)
+	if errors.Is(err, ports.ErrResetTokenInvalid) {
+		apperror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not reset password"))
+		return
+	}
+
+	if !u.passwordChanged(c, user) {
+		return
+	}
+	util.Response(c, "password reset, please log in again", http.StatusOK, "success", nil)
+}
+
+// ChangePassword sets a new password with the current one and logs the user out everywhere,
+// including the session making the request
+func (u *HTTPHandler) ChangePassword(c *gin.Context) {
+	changeRequest := &models.ChangePasswordRequest{}
+	if !bindRequest(c, changeRequest) {
+		return
+	}
+
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	// the current password is throttled like a login, so it cannot be guessed here instead
+	accountKey := loginAccountKey(models.AudienceUser, user.Email)
+	if !u.reserveLoginAttempt(c, accountKey) {
+		return
+	}
+	if !checkPassword(user.Password, changeRequest.CurrentPassword) {
+		apperror.Respond(c, apperror.New(apperror.CodeWrongPassword, "invalid password"))
+		return
+	}
+	if !u.releaseLoginAttempt(c, accountKey) {
+		return
+	}
+
+	hashPass, err := util.HashPassword(changeRequest.NewPassword)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not hash password"))
+		return
+	}
+	if err := u.Repository.UpdatePassword(user, hashPass); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not change password"))
+		return
+	}
+
+	if !u.passwordChanged(c, user) {
+		return
+	}
+	util.Response(c, "password changed, please log in again", http.StatusOK, "success", nil)
+}
+
+// passwordChanged revokes every session of a user whose password changed, lifts the login
+// lockout and lets the user know. It responds and returns false if that fails.
+func (u *HTTPHandler) passwordChanged(c *gin.Context, user *models.User) bool {
+	if err := u.Repository.RevokeAllSessions(models.AudienceUser, user.ID); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not revoke sessions"))
+		return false
+	}
+	if err := u.Repository.ClearLoginFailures(loginAccountKey(models.AudienceUser, user.Email)); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not revoke sessions"))
+		return false
+	}
+
+	// the password has changed already, a failed notification should not report otherwise
+	if err := u.Notifier.Notify(models.Notification{
+		To:      user.Email,
+		Subject: "Your password was changed",
+		Body:    "The password of your account was changed and every session was logged out. If it was not you, reset your password now.",
+	}); err != nil {
+		log.Printf("notify password change errors: %v\n", err)
+	}
+	return true
+}
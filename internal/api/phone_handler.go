@@ -0,0 +1,149 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"payment-system-one/internal/validation"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// SendPhoneOTP texts the logged in user a code to verify their phone number, or a new number they
+// give, at most once per PhoneOTPResendInterval. The number only changes once the code is verified.
+func (u *HTTPHandler) SendPhoneOTP(c *gin.Context) {
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	otpRequest := &models.PhoneOTPRequest{}
+	if !bindRequest(c, otpRequest) {
+		return
+	}
+
+	phone := otpRequest.Phone
+	if phone == "" {
+		phone = user.Phone
+	}
+	phone, err = util.NormalizePhone(phone, u.Config.DefaultPhoneCountryCode)
+	if err != nil {
+		invalidField(c, "phone", validation.CodeInvalidPhone, err.Error())
+		return
+	}
+	if user.IsPhoneVerified() && phone == user.Phone {
+		apperror.Respond(c, apperror.New(apperror.CodeAlreadyVerified, "phone already verified"))
+		return
+	}
+
+	last, err := u.Repository.LastPhoneOTP(user)
+	if err != nil && !errors.Is(err, ports.ErrPhoneOTPInvalid) {
+		apperror.Respond(c, apperror.Unexpected(err, "could not send code"))
+		return
+	}
+	if last != nil {
+		if wait := time.Until(last.CreatedAt.Add(u.Config.PhoneOTPResendInterval)); wait > 0 {
+			retryAfter := wait.Round(time.Second) + time.Second
+			c.Header("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+			apperror.Respond(c, apperror.New(apperror.CodeRateLimited,
+				"a code was sent recently, try again in "+retryAfter.String()))
+			return
+		}
+	}
+
+	code, err := util.GenerateOTP(models.PhoneOTPLength)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not send code"))
+		return
+	}
+	codeHash, err := util.HashPIN(code)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not send code"))
+		return
+	}
+
+	otp := &models.PhoneOTP{
+		UserID:    user.ID,
+		Phone:     phone,
+		CodeHash:  codeHash,
+		ExpiresAt: time.Now().Add(u.Config.PhoneOTPTTL),
+	}
+	if err := u.Repository.CreatePhoneOTP(otp); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not send code"))
+		return
+	}
+
+	message := fmt.Sprintf("Your verification code is %s. It expires in %s.", code, u.Config.PhoneOTPTTL)
+	if err := u.SMS.SendSMS(phone, message); err != nil {
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeUpstreamUnavailable, "could not send code"))
+		return
+	}
+	util.Response(c, "code sent", http.StatusOK, gin.H{"phone": phone, "expires_at": otp.ExpiresAt}, nil)
+}
+
+// VerifyPhone verifies the phone number the logged in user's last code was sent to. A code stops
+// working once it expires or PhoneOTPMaxAttempts wrong codes have been tried.
+func (u *HTTPHandler) VerifyPhone(c *gin.Context) {
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	verifyRequest := &models.VerifyPhoneRequest{}
+	if !bindRequest(c, verifyRequest) {
+		return
+	}
+
+	otp, err := u.Repository.LastPhoneOTP(user)
+	if errors.Is(err, ports.ErrPhoneOTPInvalid) {
+		apperror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not verify phone"))
+		return
+	}
+	if otp.UsedAt != nil || time.Now().After(otp.ExpiresAt) {
+		apperror.Respond(c, ports.ErrPhoneOTPInvalid)
+		return
+	}
+
+	attempts, err := u.Repository.ReservePhoneOTPAttempt(otp, u.Config.PhoneOTPMaxAttempts)
+	if errors.Is(err, ports.ErrPhoneOTPAttemptsExceeded) {
+		apperror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not verify phone"))
+		return
+	}
+
+	if bcrypt.CompareHashAndPassword([]byte(otp.CodeHash), []byte(verifyRequest.Code)) != nil {
+		remaining := u.Config.PhoneOTPMaxAttempts - attempts
+		if remaining <= 0 {
+			apperror.Respond(c, ports.ErrPhoneOTPAttemptsExceeded)
+			return
+		}
+		apperror.Respond(c, apperror.New(apperror.CodeInvalidOTP, fmt.Sprintf("wrong code, %d attempts left", remaining)))
+		return
+	}
+
+	err = u.Repository.VerifyPhone(user, otp)
+	if errors.Is(err, ports.ErrPhoneOTPInvalid) {
+		apperror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not verify phone"))
+		return
+	}
+	util.Response(c, "phone verified", http.StatusOK, gin.H{"phone": otp.Phone}, nil)
+}
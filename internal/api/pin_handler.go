@@ -0,0 +1,134 @@
+package api
+
+import (
+	"errors"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// authorizePIN checks the transaction PIN of a debit. The attempt is counted towards the lockout
+// before the PIN is compared and cleared when it is right. It responds and returns false if the
+// debit must not go ahead.
+func (u *HTTPHandler) authorizePIN(c *gin.Context, user *models.User, pin string) bool {
+	if !user.HasPIN() {
+		apperror.Respond(c, apperror.New(apperror.CodePINNotSet, "set a transaction PIN before making payments"))
+		return false
+	}
+
+	lockedUntil, err := u.Repository.ReservePINAttempt(user, u.Config.PINMaxAttempts, u.Config.PINLockout)
+	if errors.Is(err, ports.ErrPINLocked) && lockedUntil != nil {
+		pinLocked(c, *lockedUntil)
+		return false
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not check PIN"))
+		return false
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(user.PINHash), []byte(pin)); err != nil {
+		if lockedUntil != nil {
+			pinLocked(c, *lockedUntil)
+			return false
+		}
+		apperror.Respond(c, apperror.New(apperror.CodeWrongPIN, "incorrect transaction PIN"))
+		return false
+	}
+
+	if err := u.Repository.ResetPINFailures(user); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not check PIN"))
+		return false
+	}
+	return true
+}
+
+// pinLocked answers a debit refused because PIN use is locked until lockedUntil
+func pinLocked(c *gin.Context, lockedUntil time.Time) {
+	apperror.Respond(c, apperror.New(apperror.CodePINLocked, "too many wrong PINs, try again after "+lockedUntil.Format(time.RFC3339)))
+}
+
+// SetPIN sets the transaction PIN, or resets a forgotten or locked one, with the account password
+// and the two-factor code when two-factor authentication is on
+func (u *HTTPHandler) SetPIN(c *gin.Context) {
+	pinRequest := &models.SetPINRequest{}
+	if !bindRequest(c, pinRequest) {
+		return
+	}
+
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	// the password and code are throttled like a login, so they cannot be guessed here instead
+	accountKey := loginAccountKey(models.AudienceUser, user.Email)
+	if !u.reserveLoginAttempt(c, accountKey) {
+		return
+	}
+	if !checkPassword(user.Password, pinRequest.Password) {
+		apperror.Respond(c, apperror.New(apperror.CodeWrongPassword, "invalid password"))
+		return
+	}
+
+	if user.TOTPEnabled {
+		subject := &mfaSubject{audience: models.AudienceUser, id: user.ID, email: user.Email, totp: user.TOTP}
+		ok, err := u.verifySecondFactor(subject, pinRequest.Code, true)
+		if err != nil {
+			apperror.Respond(c, apperror.Unexpected(err, "could not verify code"))
+			return
+		}
+		if !ok {
+			apperror.Respond(c, apperror.New(apperror.CodeWrongMFACode, "invalid two-factor code"))
+			return
+		}
+	}
+	if !u.releaseLoginAttempt(c, accountKey) {
+		return
+	}
+
+	pinHash, err := util.HashPIN(pinRequest.PIN)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not hash PIN"))
+		return
+	}
+	if err := u.Repository.SetPIN(user, pinHash); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not set PIN"))
+		return
+	}
+	util.Response(c, "transaction PIN set", 200, "success", nil)
+}
+
+// ChangePIN replaces the transaction PIN with the current one
+func (u *HTTPHandler) ChangePIN(c *gin.Context) {
+	pinRequest := &models.ChangePINRequest{}
+	if !bindRequest(c, pinRequest) {
+		return
+	}
+
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if !u.authorizePIN(c, user, pinRequest.CurrentPIN) {
+		return
+	}
+
+	pinHash, err := util.HashPIN(pinRequest.NewPIN)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not hash PIN"))
+		return
+	}
+	if err := u.Repository.SetPIN(user, pinHash); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not change PIN"))
+		return
+	}
+	util.Response(c, "transaction PIN changed", 200, "success", nil)
+}
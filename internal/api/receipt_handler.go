@@ -0,0 +1,95 @@
+package api
+
+import (
+	"fmt"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// findUserTransaction returns the transaction with the reference in the path if the user took part in it
+func (u *HTTPHandler) findUserTransaction(c *gin.Context, user *models.User) (*models.Transaction, bool) {
+	transaction, err := u.Repository.FindTransactionByReference(c.Param("reference"))
+	if err != nil {
+		apperror.Respond(c, err)
+		return nil, false
+	}
+	if transaction.PayerAccountNumber != user.AccountNo && transaction.RecipientAccountNumber != user.AccountNo {
+		apperror.Respond(c, apperror.New(apperror.CodeTransactionNotFound, ports.ErrTransactionNotFound.Error()))
+		return nil, false
+	}
+	return transaction, true
+}
+
+// TransactionByReference returns one of the user's transactions by its reference
+func (u *HTTPHandler) TransactionByReference(c *gin.Context) {
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	transaction, ok := u.findUserTransaction(c, user)
+	if !ok {
+		return
+	}
+	util.Response(c, "transaction successfully retrieved", 200, models.NewTransactionResponse(transaction), nil)
+}
+
+// TransactionReceipt returns the receipt of one of the user's transactions as JSON, or as a PDF download with ?format=pdf
+func (u *HTTPHandler) TransactionReceipt(c *gin.Context) {
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	format := c.DefaultQuery("format", "json")
+	if format != "json" && format != "pdf" {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "format must be json or pdf"))
+		return
+	}
+
+	transaction, ok := u.findUserTransaction(c, user)
+	if !ok {
+		return
+	}
+
+	total, err := transaction.TransactionAmount.Add(transaction.TransactionFee)
+	if err != nil {
+		total = transaction.TransactionAmount
+	}
+	receipt := &models.Receipt{
+		Reference:       transaction.Reference,
+		TransactionType: transaction.TransactionType,
+		Status:          transaction.Status,
+		Payer:           u.receiptParty(transaction.PayerAccountNumber),
+		Recipient:       u.receiptParty(transaction.RecipientAccountNumber),
+		Amount:          transaction.TransactionAmount,
+		Fee:             transaction.TransactionFee,
+		Total:           total,
+		TransactionDate: transaction.TransactionDate,
+	}
+
+	if format == "pdf" {
+		c.Header("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.pdf"`, receipt.Reference))
+		c.Data(200, "application/pdf", util.TextPDF(receipt.Lines()))
+		return
+	}
+	util.Response(c, "receipt successfully retrieved", 200, receipt, nil)
+}
+
+// receiptParty names the holder of an account number on a receipt. Top-ups have no payer account.
+func (u *HTTPHandler) receiptParty(accountNo int) models.ReceiptParty {
+	if accountNo == 0 {
+		return models.ReceiptParty{Name: "External funding"}
+	}
+	user, err := u.Repository.FindUserByAccountNumber(accountNo)
+	if err != nil {
+		return models.ReceiptParty{Name: "Unknown account", AccountNo: accountNo}
+	}
+	return models.ReceiptParty{Name: user.FirstName + " " + user.LastName, AccountNo: accountNo}
+}
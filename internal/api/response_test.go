@@ -0,0 +1,346 @@
+package api
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/pem"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"payment-system-one/internal/middleware"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/validation"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+)
+
+const (
+	testPassword    = "Correct-Horse-42"
+	testPIN         = "4821"
+	testPhoneCode   = "123456"
+	testDateOfBirth = "1990-05-21"
+	testAddress     = "12 Marina Road, Lagos"
+	testTOTPSecret  = "JBSWY3DPEHPK3PXP"
+)
+
+// leaks are what no response may contain: bcrypt hashes, PIN and second factor fields, and the
+// personal details kept on users and admins
+var leaks = regexp.MustCompile(`\$2a\$|\bpin\b|pin_?hash|pin_?failed|pin_?locked|totp|secret|date_?of_?birth|address|` +
+	regexp.QuoteMeta(strings.ToLower(testDateOfBirth)) + `|` + regexp.QuoteMeta(strings.ToLower(testAddress)) + `|` +
+	regexp.QuoteMeta(strings.ToLower(testTOTPSecret)))
+
+func TestMain(m *testing.M) {
+	gin.SetMode(gin.TestMode)
+	if err := validation.Register("234"); err != nil {
+		panic(err)
+	}
+	os.Exit(m.Run())
+}
+
+// fakeRepository answers the calls of the handlers under test with fixtures carrying every
+// secret a stored user or admin has. Calls it does not implement panic on the nil Repository.
+type fakeRepository struct {
+	ports.Repository
+	user        *models.User
+	admin       *models.Admin
+	transaction *models.Transaction
+	otp         *models.PhoneOTP
+	// released are the login attempts taken back
+	released []models.LoginLimit
+}
+
+func newFakeRepository(t *testing.T) *fakeRepository {
+	t.Helper()
+	hash := func(secret string) string {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(secret), bcrypt.MinCost)
+		if err != nil {
+			t.Fatalf("hash: %v", err)
+		}
+		return string(hashed)
+	}
+
+	now := time.Now()
+	totp := models.TOTP{TOTPSecret: testTOTPSecret, TOTPLastStep: 42}
+	return &fakeRepository{
+		user: &models.User{
+			Model:           gorm.Model{ID: 1, CreatedAt: now},
+			FirstName:       "Ada",
+			LastName:        "Obi",
+			Password:        hash(testPassword),
+			DateOfBirth:     testDateOfBirth,
+			Email:           "ada@example.com",
+			AccountNo:       1234567890,
+			Phone:           "+2348012345678",
+			Address:         testAddress,
+			EmailVerifiedAt: &now,
+			TOTP:            totp,
+			PIN:             models.PIN{PINHash: hash(testPIN), PINFailedAttempts: 1},
+		},
+		admin: &models.Admin{
+			Model:       gorm.Model{ID: 2, CreatedAt: now},
+			FirstName:   "Bola",
+			LastName:    "Ade",
+			Password:    hash(testPassword),
+			DateOfBirth: testDateOfBirth,
+			Email:       "bola@example.com",
+			Phone:       "+2348087654321",
+			Address:     testAddress,
+			Role:        models.RoleSuperAdmin,
+			TOTP:        models.TOTP{TOTPSecret: testTOTPSecret, TOTPEnabled: true},
+		},
+		transaction: &models.Transaction{
+			Model:                  gorm.Model{ID: 3},
+			Reference:              "TX123",
+			PayerAccountNumber:     1234567890,
+			RecipientAccountNumber: 1234567891,
+			TransactionType:        "transfer",
+			TransactionAmount:      models.NewMoney(100000, models.DefaultCurrency),
+			TransactionFee:         models.NewMoney(0, models.DefaultCurrency),
+			TransactionDate:        now,
+			Status:                 models.TransactionCompleted,
+		},
+		otp: &models.PhoneOTP{
+			Model:     gorm.Model{ID: 4},
+			UserID:    1,
+			Phone:     "+2348012345678",
+			CodeHash:  hash(testPhoneCode),
+			ExpiresAt: now.Add(time.Hour),
+		},
+	}
+}
+
+func (f *fakeRepository) FindUserByEmail(string) (*models.User, error) { return f.user, nil }
+func (f *fakeRepository) FindUserByAccountNumber(int) (*models.User, error) {
+	return f.recipient(), nil
+}
+func (f *fakeRepository) FindAdminByEmail(string) (*models.Admin, error) {
+	return nil, ports.ErrAdminNotFound
+}
+func (f *fakeRepository) ClearLoginFailures(string) error                     { return nil }
+func (f *fakeRepository) CreateRefreshToken(*models.RefreshToken) error       { return nil }
+func (f *fakeRepository) ResetPINFailures(*models.User) error                 { return nil }
+func (f *fakeRepository) CreateAdminInvitation(*models.AdminInvitation) error { return nil }
+func (f *fakeRepository) SaveExchangeRate(*models.ExchangeRate) error         { return nil }
+
+func (f *fakeRepository) ReserveLoginAttempt([]models.LoginLimit, time.Duration) (*models.LoginThrottle, error) {
+	return nil, nil
+}
+
+func (f *fakeRepository) ReleaseLoginAttempt(limit models.LoginLimit, lockout time.Duration) error {
+	f.released = append(f.released, limit)
+	return nil
+}
+
+func (f *fakeRepository) ReservePINAttempt(*models.User, int, time.Duration) (*time.Time, error) {
+	return nil, nil
+}
+
+// recipient is another user with the same kind of secrets, whom transfers and receipts look up
+func (f *fakeRepository) recipient() *models.User {
+	recipient := *f.user
+	recipient.ID, recipient.AccountNo, recipient.Email = 5, 1234567891, "chidi@example.com"
+	return &recipient
+}
+
+func (f *fakeRepository) TransferFunds(*models.User, *models.User, models.Money, models.Money) (*models.Transaction, error) {
+	return f.transaction, nil
+}
+
+func (f *fakeRepository) AddFunds(*models.User, models.Money) (*models.Transaction, error) {
+	return f.transaction, nil
+}
+
+func (f *fakeRepository) Transactions(models.TransactionFilter) (*models.TransactionPage, error) {
+	return &models.TransactionPage{Transactions: []models.Transaction{*f.transaction}, NextCursor: "next"}, nil
+}
+
+func (f *fakeRepository) FindTransaction(uint) (*models.Transaction, error) {
+	return f.transaction, nil
+}
+
+func (f *fakeRepository) FindTransactionByReference(string) (*models.Transaction, error) {
+	return f.transaction, nil
+}
+
+func (f *fakeRepository) Wallets(*models.User) ([]models.Wallet, error) {
+	wallet, _ := f.OpenWallet(f.user, models.DefaultCurrency)
+	return []models.Wallet{*wallet}, nil
+}
+
+func (f *fakeRepository) OpenWallet(user *models.User, currency string) (*models.Wallet, error) {
+	return &models.Wallet{AccountNo: user.AccountNo, Balance: models.NewMoney(500000, currency)}, nil
+}
+
+func (f *fakeRepository) ExchangeRates() ([]models.ExchangeRate, error) {
+	rate, _ := f.FindExchangeRate("USD", models.DefaultCurrency)
+	return []models.ExchangeRate{*rate}, nil
+}
+
+func (f *fakeRepository) FindExchangeRate(from, to string) (*models.ExchangeRate, error) {
+	return &models.ExchangeRate{BaseCurrency: "USD", QuoteCurrency: models.DefaultCurrency, Rate: "1500", SpreadBps: 100}, nil
+}
+
+func (f *fakeRepository) CreateFXQuote(quote *models.FXQuote) error {
+	quote.ID = 6
+	return nil
+}
+
+func (f *fakeRepository) ExecuteFXQuote(*models.User, uint) ([]models.Transaction, error) {
+	return []models.Transaction{*f.transaction, *f.transaction}, nil
+}
+
+func (f *fakeRepository) ReconcileBalance(accountNo int) ([]models.Reconciliation, error) {
+	balance := models.NewMoney(500000, models.DefaultCurrency)
+	return []models.Reconciliation{{
+		AccountNo:     accountNo,
+		StoredBalance: balance,
+		LedgerBalance: balance,
+		Difference:    models.NewMoney(0, models.DefaultCurrency),
+		Balanced:      true,
+	}}, nil
+}
+
+func (f *fakeRepository) ReverseTransaction(id uint, amount models.Money, reason, reversedBy string, allowNegative bool) (*models.Reversal, error) {
+	return &models.Reversal{
+		Model:         gorm.Model{ID: 7},
+		TransactionID: id,
+		Amount:        f.transaction.TransactionAmount,
+		Reason:        reason,
+		ReversedBy:    reversedBy,
+	}, nil
+}
+
+func (f *fakeRepository) Reversals(transactionID uint) ([]models.Reversal, error) {
+	reversal, _ := f.ReverseTransaction(transactionID, models.Money{}, "duplicate", f.admin.Email, false)
+	return []models.Reversal{*reversal}, nil
+}
+
+func (f *fakeRepository) SetAdminRole(id uint, role string) (*models.Admin, error) {
+	admin := *f.admin
+	admin.ID, admin.Role = id, role
+	return &admin, nil
+}
+
+func (f *fakeRepository) LastPhoneOTP(*models.User) (*models.PhoneOTP, error) { return f.otp, nil }
+func (f *fakeRepository) ReservePhoneOTPAttempt(*models.PhoneOTP, int) (int, error) {
+	return 1, nil
+}
+func (f *fakeRepository) VerifyPhone(*models.User, *models.PhoneOTP) error { return nil }
+
+// testKeys writes an Ed25519 signing key to a temporary directory and loads it
+func testKeys(t *testing.T) *middleware.KeySet {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	dir := t.TempDir()
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "test.pem"), data, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	keys, err := middleware.LoadKeySet(dir, "test", "payment-system-one", 30*time.Second)
+	if err != nil {
+		t.Fatalf("load keys: %v", err)
+	}
+	return keys
+}
+
+func TestResponsesLeakNoSecrets(t *testing.T) {
+	repository := newFakeRepository(t)
+	handler := NewHTTPHandler(repository, nil, nil, Config{
+		TransferFee:         models.NewMoney(0, models.DefaultCurrency),
+		FXQuoteTTL:          time.Minute,
+		FXSpreadBps:         100,
+		AdminInvitationTTL:  time.Hour,
+		Keys:                testKeys(t),
+		PINMaxAttempts:      5,
+		PINLockout:          time.Hour,
+		LoginMaxFailures:    5,
+		LoginIPMaxFailures:  20,
+		LoginLockout:        time.Hour,
+		PhoneOTPMaxAttempts: 5,
+	})
+
+	tests := []struct {
+		name    string
+		handler gin.HandlerFunc
+		method  string
+		path    string
+		params  gin.Params
+		body    string
+	}{
+		{"LoginUser", handler.LoginUser, http.MethodPost, "/login", nil,
+			`{"email":"ada@example.com","password":"` + testPassword + `"}`},
+		{"GetUserByEmail", handler.GetUserByEmail, http.MethodGet, "/admin/user?email=ada@example.com", nil, ""},
+		{"TransferFunds", handler.TransferFunds, http.MethodPost, "/user/transfer", nil,
+			`{"account_no":1234567891,"amount":"1000","pin":"` + testPIN + `"}`},
+		{"AddMoney", handler.AddMoney, http.MethodPost, "/user/addfunds", nil, `{"amount":"1000"}`},
+		{"BalanceCheck", handler.BalanceCheck, http.MethodGet, "/user/balance", nil, ""},
+		{"UserTransactionHistory", handler.UserTransactionHistory, http.MethodGet, "/user/transaction", nil, ""},
+		{"Dashboard", handler.Dashboard, http.MethodGet, "/user/dashboard", nil, ""},
+		{"TransactionByReference", handler.TransactionByReference, http.MethodGet, "/user/transaction/TX123",
+			gin.Params{{Key: "reference", Value: "TX123"}}, ""},
+		{"TransactionReceipt", handler.TransactionReceipt, http.MethodGet, "/user/transaction/TX123/receipt",
+			gin.Params{{Key: "reference", Value: "TX123"}}, ""},
+		{"OpenWallet", handler.OpenWallet, http.MethodPost, "/user/wallet", nil, `{"currency":"USD"}`},
+		{"ExchangeRates", handler.ExchangeRates, http.MethodGet, "/user/fx/rates", nil, ""},
+		{"FXQuote", handler.FXQuote, http.MethodPost, "/user/fx/quote", nil,
+			`{"from_currency":"USD","to_currency":"NGN","amount":"10"}`},
+		{"FXConvert", handler.FXConvert, http.MethodPost, "/user/fx/convert", nil,
+			`{"quote_id":6,"pin":"` + testPIN + `"}`},
+		{"VerifyPhone", handler.VerifyPhone, http.MethodPost, "/user/phone/verify", nil,
+			`{"code":"` + testPhoneCode + `"}`},
+		{"ReconcileBalance", handler.ReconcileBalance, http.MethodGet, "/admin/ledger/reconcile?account_no=1234567890", nil, ""},
+		{"SetExchangeRate", handler.SetExchangeRate, http.MethodPut, "/admin/fx/rates", nil,
+			`{"base_currency":"USD","quote_currency":"NGN","rate":"1500"}`},
+		{"ReverseTransaction", handler.ReverseTransaction, http.MethodPost, "/admin/transaction/3/reverse",
+			gin.Params{{Key: "id", Value: "3"}}, `{"reason":"duplicate"}`},
+		{"TransactionReversals", handler.TransactionReversals, http.MethodGet, "/admin/transaction/3/reversals",
+			gin.Params{{Key: "id", Value: "3"}}, ""},
+		{"SetAdminRole", handler.SetAdminRole, http.MethodPut, "/admin/9/role",
+			gin.Params{{Key: "id", Value: "9"}}, `{"role":"finance"}`},
+		{"InviteAdmin", handler.InviteAdmin, http.MethodPost, "/admin/invitations", nil,
+			`{"email":"new@example.com","role":"support"}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			recorder := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(recorder)
+			c.Request = httptest.NewRequest(tt.method, tt.path, strings.NewReader(tt.body))
+			c.Request.Header.Set("Content-Type", "application/json")
+			c.Params = tt.params
+			c.Set("user", repository.user)
+			c.Set("admin", repository.admin)
+
+			tt.handler(c)
+
+			body := recorder.Body.String()
+			if recorder.Code != http.StatusOK {
+				t.Fatalf("status %d, want 200: %s", recorder.Code, body)
+			}
+			// signed tokens are opaque, drop them so their encoding cannot match by chance
+			for _, header := range []string{"access_token", "refresh_token"} {
+				if token := recorder.Header().Get(header); token != "" {
+					body = strings.ReplaceAll(body, token, "")
+				}
+			}
+			if leak := leaks.FindString(strings.ToLower(body)); leak != "" {
+				t.Errorf("response contains %q: %s", leak, body)
+			}
+		})
+	}
+}
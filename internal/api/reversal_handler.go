@@ -0,0 +1,81 @@
+package api
+
+import (
+	"errors"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+)
+
+// ReverseTransaction reverses all or part of a transfer or top-up
+func (u *HTTPHandler) ReverseTransaction(c *gin.Context) {
+	reversalRequest := &models.ReversalRequest{}
+	if !bindRequest(c, reversalRequest) {
+		return
+	}
+
+	admin, err := u.GetAdminFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "invalid transaction id"))
+		return
+	}
+
+	transaction, err := u.Repository.FindTransaction(uint(id))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	//an empty amount reverses everything not reversed yet
+	amount := models.NewMoney(0, transaction.TransactionAmount.Currency)
+	if reversalRequest.Amount != "" {
+		amount, err = models.ParseMoney(reversalRequest.Amount, transaction.TransactionAmount.Currency)
+		if err != nil {
+			invalidAmount(c, err)
+			return
+		}
+	}
+
+	// a request can refuse to overdraw the recipient, not allow what the configuration does not
+	allowNegative := u.Config.ReversalAllowNegative
+	if reversalRequest.AllowNegativeBalance != nil {
+		allowNegative = allowNegative && *reversalRequest.AllowNegativeBalance
+	}
+
+	reversal, err := u.Repository.ReverseTransaction(transaction.ID, amount, reversalRequest.Reason, admin.Email, allowNegative)
+	switch {
+	case errors.Is(err, ports.ErrInsufficientFunds):
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeInsufficientFunds, "recipient has already spent the money"))
+	case err != nil:
+		// reversal rules and missing wallets carry their own codes
+		apperror.Respond(c, apperror.Unexpected(err, "reversal failed"))
+	default:
+		util.Response(c, "reversal successful", 200, models.NewReversalResponse(reversal), nil)
+	}
+}
+
+// TransactionReversals lists the reversals of a transaction
+func (u *HTTPHandler) TransactionReversals(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "invalid transaction id"))
+		return
+	}
+
+	reversals, err := u.Repository.Reversals(uint(id))
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not retrieve reversals"))
+		return
+	}
+	util.Response(c, "reversals successfully retrieved", 200, models.NewReversalResponses(reversals), nil)
+}
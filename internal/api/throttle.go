@@ -0,0 +1,116 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// dummyPasswordHash is compared against when there is no such account, so that a login for an
+// unknown email takes as long as one with a wrong password
+const dummyPasswordHash = "$2a$14$PTZvgW7OCjdEBt4YUZl6KeCjw09c5FFchNJEiDZTZArcE4pI7N2z."
+
+// checkPassword compares a password with the hash of an account, or with a dummy hash if there is none
+func checkPassword(passwordHash string, password string) bool {
+	if passwordHash == "" {
+		bcrypt.CompareHashAndPassword([]byte(dummyPasswordHash), []byte(password))
+		return false
+	}
+	return bcrypt.CompareHashAndPassword([]byte(passwordHash), []byte(password)) == nil
+}
+
+// loginAccountKey is the throttle key of the email a user or admin logs in with
+func loginAccountKey(audience string, email string) string {
+	return models.LoginAccountKey(audience, strings.ToLower(strings.TrimSpace(email)))
+}
+
+// loginLimits are the throttle keys a login attempt counts against: its account and the client IP
+func (u *HTTPHandler) loginLimits(c *gin.Context, accountKey string) []models.LoginLimit {
+	return []models.LoginLimit{
+		{Key: accountKey, MaxFailures: u.Config.LoginMaxFailures},
+		{Key: models.LoginIPKey(c.ClientIP()), MaxFailures: u.Config.LoginIPMaxFailures},
+	}
+}
+
+// reserveLoginAttempt counts an attempt against the account and the client IP before the password
+// or code is checked, which delays the next attempt progressively and locks them out after too
+// many. It responds with 429 and Retry-After and returns false while either is locked out.
+func (u *HTTPHandler) reserveLoginAttempt(c *gin.Context, accountKey string) bool {
+	throttle, err := u.Repository.ReserveLoginAttempt(u.loginLimits(c, accountKey), u.Config.LoginLockout)
+	if errors.Is(err, ports.ErrLoginLocked) && throttle != nil && throttle.LockedUntil != nil {
+		retryAfter := time.Until(*throttle.LockedUntil).Round(time.Second) + time.Second
+		c.Header("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+		apperror.Respond(c, apperror.New(apperror.CodeTooManyAttempts,
+			"too many failed attempts, try again in "+retryAfter.String()))
+		return false
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not check credentials"))
+		return false
+	}
+	return true
+}
+
+// releaseLoginAttempt takes back the attempt reserved against the account by reserveLoginAttempt
+// once the password or code is right. The attempt stays counted against the client IP, so one
+// account that can log in does not make room to guess the passwords of others. It responds and
+// returns false if that fails.
+func (u *HTTPHandler) releaseLoginAttempt(c *gin.Context, accountKey string) bool {
+	limit := models.LoginLimit{Key: accountKey, MaxFailures: u.Config.LoginMaxFailures}
+	if err := u.Repository.ReleaseLoginAttempt(limit, u.Config.LoginLockout); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not check credentials"))
+		return false
+	}
+	return true
+}
+
+// UnlockUserLogin lets an admin lift the login lockout of a user
+func (u *HTTPHandler) UnlockUserLogin(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "invalid user id"))
+		return
+	}
+
+	user, err := u.Repository.FindUserByID(uint(id))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := u.Repository.ClearLoginFailures(loginAccountKey(models.AudienceUser, user.Email)); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not unlock user"))
+		return
+	}
+	util.Response(c, "user unlocked", 200, "success", nil)
+}
+
+// UnlockAdminLogin lets an admin lift the login lockout of another admin
+func (u *HTTPHandler) UnlockAdminLogin(c *gin.Context) {
+	id, err := strconv.ParseUint(c.Param("id"), 10, 64)
+	if err != nil {
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "invalid admin id"))
+		return
+	}
+
+	admin, err := u.Repository.FindAdminByID(uint(id))
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := u.Repository.ClearLoginFailures(loginAccountKey(models.AudienceAdmin, admin.Email)); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not unlock admin"))
+		return
+	}
+	util.Response(c, "admin unlocked", 200, "success", nil)
+}
@@ -0,0 +1,37 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"payment-system-one/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestLoginReleasesOnlyTheAccountAttempt(t *testing.T) {
+	repository := newFakeRepository(t)
+	handler := NewHTTPHandler(repository, nil, nil, Config{
+		Keys:               testKeys(t),
+		LoginMaxFailures:   5,
+		LoginIPMaxFailures: 20,
+		LoginLockout:       time.Hour,
+	})
+
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/login",
+		strings.NewReader(`{"email":"ada@example.com","password":"`+testPassword+`"}`))
+	c.Request.Header.Set("Content-Type", "application/json")
+	handler.LoginUser(c)
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("status %d, want 200: %s", recorder.Code, recorder.Body)
+	}
+	want := models.LoginLimit{Key: loginAccountKey(models.AudienceUser, "ada@example.com"), MaxFailures: 5}
+	if len(repository.released) != 1 || repository.released[0] != want {
+		t.Errorf("released %+v, want only %+v", repository.released, want)
+	}
+}
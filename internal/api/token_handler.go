@@ -0,0 +1,177 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/middleware"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// newRefreshToken returns an unsaved refresh token with a fresh token id, valid for RefreshTokenValidity,
+// and the id of the access token issued along with it
+func newRefreshToken() (*models.RefreshToken, error) {
+	tokenID, err := util.GenerateTokenID()
+	if err != nil {
+		return nil, err
+	}
+	accessTokenID, err := util.GenerateTokenID()
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	return &models.RefreshToken{
+		TokenID:         tokenID,
+		ExpiresAt:       now.Add(middleware.RefreshTokenValidity),
+		AccessTokenID:   accessTokenID,
+		AccessExpiresAt: now.Add(middleware.AccessTokenValidity),
+	}, nil
+}
+
+// startSession persists the first refresh token of a new family for the user or admin subjectID
+// and returns a signed access and refresh token. The failed logins of the account are forgotten.
+func (u *HTTPHandler) startSession(email string, audience string, subjectID uint) (*string, *string, error) {
+	if err := u.Repository.ClearLoginFailures(loginAccountKey(audience, email)); err != nil {
+		return nil, nil, err
+	}
+
+	refreshToken, err := newRefreshToken()
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken.FamilyID, err = util.GenerateTokenID()
+	if err != nil {
+		return nil, nil, err
+	}
+	refreshToken.Audience = audience
+	refreshToken.SubjectID = subjectID
+
+	if err := u.Repository.CreateRefreshToken(refreshToken); err != nil {
+		return nil, nil, err
+	}
+	return u.signTokens(email, refreshToken)
+}
+
+// signTokens signs an access token for email and the refresh token
+func (u *HTTPHandler) signTokens(email string, refreshToken *models.RefreshToken) (*string, *string, error) {
+	accessClaims, refreshClaims := middleware.GenerateClaims(email, refreshToken)
+
+	accessToken, err := middleware.GenerateToken(u.Config.Keys, accessClaims)
+	if err != nil {
+		return nil, nil, err
+	}
+	signedRefreshToken, err := middleware.GenerateToken(u.Config.Keys, refreshClaims)
+	if err != nil {
+		return nil, nil, err
+	}
+	return accessToken, signedRefreshToken, nil
+}
+
+// RefreshToken exchanges a refresh token for a new access token and a new refresh token. The
+// old refresh token cannot be used again; replaying it revokes every token descended from the same login.
+func (u *HTTPHandler) RefreshToken(c *gin.Context) {
+	refreshRequest := &models.RefreshRequest{}
+	if !bindRequest(c, refreshRequest) {
+		return
+	}
+
+	_, claims, err := middleware.AuthorizeToken(&refreshRequest.RefreshToken, u.Config.Keys,
+		middleware.AudienceUser, middleware.AudienceAdmin)
+	if err != nil || claims["token_use"] != middleware.TokenUseRefresh {
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeInvalidToken, "invalid refresh token"))
+		return
+	}
+	tokenID, _ := claims["jti"].(string)
+
+	next, err := newRefreshToken()
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "error generating refresh token"))
+		return
+	}
+
+	rotated, err := u.Repository.RotateRefreshToken(tokenID, next)
+	if errors.Is(err, ports.ErrRefreshTokenReused) {
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeTokenReused, "refresh token has already been used, please log in again"))
+		return
+	}
+	if errors.Is(err, ports.ErrRefreshTokenInvalid) {
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeInvalidToken, "invalid refresh token"))
+		return
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not refresh token"))
+		return
+	}
+
+	var email string
+	switch rotated.Audience {
+	case middleware.AudienceAdmin:
+		admin, err := u.Repository.FindAdminByID(rotated.SubjectID)
+		if err != nil {
+			apperror.Respond(c, apperror.Wrap(err, apperror.CodeInvalidToken, "invalid refresh token"))
+			return
+		}
+		email = admin.Email
+	default:
+		user, err := u.Repository.FindUserByID(rotated.SubjectID)
+		if err != nil {
+			apperror.Respond(c, apperror.Wrap(err, apperror.CodeInvalidToken, "invalid refresh token"))
+			return
+		}
+		email = user.Email
+	}
+
+	accessToken, refreshToken, err := u.signTokens(email, next)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "error generating tokens"))
+		return
+	}
+	c.Header("access_token", *accessToken)
+	c.Header("refresh_token", *refreshToken)
+
+	util.Response(c, "token refreshed", http.StatusOK, gin.H{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	}, nil)
+}
+
+// Logout revokes the access token of the request and the refresh tokens of its session
+func (u *HTTPHandler) Logout(c *gin.Context) {
+	tokenID, expiresAt, err := u.GetTokenIDFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := u.Repository.RevokeSession(tokenID, expiresAt); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not log out"))
+		return
+	}
+	util.Response(c, "logged out", http.StatusOK, "success", nil)
+}
+
+// LogoutAll revokes every access and refresh token issued to the logged in user or admin
+func (u *HTTPHandler) LogoutAll(c *gin.Context) {
+	subject, err := u.subjectFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if err := u.Repository.RevokeAllSessions(subject.audience, subject.id); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not log out"))
+		return
+	}
+	util.Response(c, "logged out of all sessions", http.StatusOK, "success", nil)
+}
+
+// JWKS publishes the public keys tokens are verified with, so other services can verify them
+func (u *HTTPHandler) JWKS(c *gin.Context) {
+	c.Header("Cache-Control", "public, max-age=300")
+	c.JSON(http.StatusOK, u.Config.Keys.JWKS())
+}
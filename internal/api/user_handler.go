@@ -1,42 +1,61 @@
 package api
 
 import (
+	"errors"
+	"log"
 	"net/http"
-	"os"
+	"payment-system-one/internal/apperror"
 	"payment-system-one/internal/middleware"
 	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
 	"payment-system-one/internal/util"
+	"payment-system-one/internal/validation"
 
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
-	"golang.org/x/crypto/bcrypt"
 )
 
 // Create a user
 func (u *HTTPHandler) RegisterUser(c *gin.Context) {
-	var user *models.User
-	if err := c.ShouldBind(&user); err != nil {
-		util.Response(c, "invalid request", 400, "bad request body", nil)
+	registration := &models.RegisterUserRequest{}
+	if !bindRequest(c, registration) {
 		return
 	}
 
-	//validate user email
-	if !util.IsValidEmail(user.Email) {
-		util.Response(c, "invalid email", 400, "Bad request body", nil)
-		return
+	//normalise phone number, it is verified later with a texted code
+	phone := ""
+	if registration.Phone != "" {
+		normalized, err := util.NormalizePhone(registration.Phone, u.Config.DefaultPhoneCountryCode)
+		if err != nil {
+			invalidField(c, "phone", validation.CodeInvalidPhone, err.Error())
+			return
+		}
+		phone = normalized
+	}
+
+	user := &models.User{
+		FirstName:   registration.FirstName,
+		LastName:    registration.LastName,
+		Email:       registration.Email,
+		DateOfBirth: registration.DateOfBirth,
+		Phone:       phone,
+		Address:     registration.Address,
 	}
 
 	//check if user already exists
 	_, err := u.Repository.FindUserByEmail(user.Email)
 	if err == nil {
-		util.Response(c, "User already exists", 400, "Bad request body", nil)
+		apperror.Respond(c, apperror.New(apperror.CodeAccountExists, "user already exists"))
+		return
+	}
+	if !errors.Is(err, ports.ErrUserNotFound) {
+		apperror.Respond(c, apperror.Unexpected(err, "user not created"))
 		return
 	}
 
 	//hash password
-	hashPass, err := util.HashPassword(user.Password)
+	hashPass, err := util.HashPassword(registration.Password)
 	if err != nil {
-		util.Response(c, "could not hash password", 500, "internal server error", nil)
+		apperror.Respond(c, apperror.Unexpected(err, "could not hash password"))
 		return
 	}
 
@@ -45,176 +64,191 @@ func (u *HTTPHandler) RegisterUser(c *gin.Context) {
 	//generate account number
 	acctNo, err := util.GenerateAccountNumber()
 	if err != nil {
-		util.Response(c, "could not generate account number", 500, "internal server error", nil)
+		apperror.Respond(c, apperror.Unexpected(err, "could not generate account number"))
 		return
 	}
 
 	user.AccountNo = acctNo
 
-	//set available balance to zero
-	user.AvailableBalance = 0.0
-
-	//persist information in the data base
+	//persist information in the data base, this opens an empty wallet in the default currency
 	err = u.Repository.CreateUser(user)
 	if err != nil {
-		util.Response(c, "user not created", 400, err.Error(), nil)
+		apperror.Respond(c, apperror.Unexpected(err, "user not created"))
 		return
 	}
-	util.Response(c, "user created", 200, "success", nil)
+
+	// the account exists either way, the user can ask for another verification
+	if err := u.sendEmailVerification(user); err != nil {
+		log.Printf("send email verification errors: %v\n", err)
+	}
+	util.Response(c, "user created, check your email to verify it", 200, "success", nil)
 }
 
 func (u *HTTPHandler) LoginUser(c *gin.Context) {
-	var loginRequest *models.LoginRequest
-	if err := c.ShouldBind(&loginRequest); err != nil {
-		util.Response(c, "invalid request", 400, "bad request body", nil)
+	loginRequest := &models.LoginRequest{}
+	if !bindRequest(c, loginRequest) {
 		return
 	}
 
-	if loginRequest.Email == "" || loginRequest.Password == "" {
-		util.Response(c, "Please enter your email and/or password", 400, "bad request body", nil)
+	accountKey := loginAccountKey(models.AudienceUser, loginRequest.Email)
+	if !u.reserveLoginAttempt(c, accountKey) {
 		return
 	}
 
+	// an unknown email and a wrong password get the same answer in the same time
 	user, err := u.Repository.FindUserByEmail(loginRequest.Email)
 	if err != nil {
-		util.Response(c, "user does not exist", 404, "user not found", nil)
+		user = &models.User{}
+	}
+	if !checkPassword(user.Password, loginRequest.Password) {
+		apperror.Respond(c, apperror.New(apperror.CodeInvalidCredentials, "invalid email or password"))
 		return
 	}
-
-	if err = bcrypt.CompareHashAndPassword([]byte(user.Password), []byte(loginRequest.Password)); err != nil {
-		util.Response(c, "invalid email or password", 400, "invalid email or password", nil)
+	if !u.releaseLoginAttempt(c, accountKey) {
 		return
 	}
-
-	//Generate token
-	accessClaims, refreshClaims := middleware.GenerateClaims(user.Email)
-
-	secret := os.Getenv("JWT_SECRET")
-
-	accessToken, err := middleware.GenerateToken(jwt.SigningMethodHS256, accessClaims, &secret)
-	if err != nil {
-		util.Response(c, "error generating access token", 500, "error generating access token", nil)
+	// users who enabled two-factor authentication get a session once they pass it
+	if user.TOTPEnabled {
+		u.requireSecondFactor(c, models.AudienceUser, user.ID, false)
 		return
 	}
-	refreshToken, err := middleware.GenerateToken(jwt.SigningMethodHS256, refreshClaims, &secret)
+
+	//Generate tokens, starting a new refresh token family
+	accessToken, refreshToken, err := u.startSession(user.Email, middleware.AudienceUser, user.ID)
 	if err != nil {
-		util.Response(c, "error generating refresh token", 500, "error generating refresh token", nil)
+		apperror.Respond(c, apperror.Unexpected(err, "error generating tokens"))
 		return
 	}
 	c.Header("access_token", *accessToken)
 	c.Header("refresh_token", *refreshToken)
 
 	util.Response(c, "login successful", http.StatusOK, gin.H{
-		"user":          user,
+		"user":          models.NewUserResponse(user),
 		"access_token":  accessToken,
 		"refresh_token": refreshToken,
 	}, nil)
 }
 
 func (u *HTTPHandler) GetUserByEmail(c *gin.Context) {
-	_, err := u.GetUserFromContext(c)
+	_, err := u.GetAdminFromContext(c)
 	if err != nil {
-		util.Response(c, "User not logged in", 500, "user not found", nil)
+		apperror.Respond(c, err)
 		return
 	}
 
 	email := c.Query("email")
 
 	if email == "" {
-		util.Response(c, "email is required", 400, "email is required", nil)
+		apperror.Respond(c, apperror.New(apperror.CodeBadRequest, "email is required"))
 		return
 	}
 
 	user, err := u.Repository.FindUserByEmail(email)
 	if err != nil {
-		util.Response(c, "user not fount", 500, "user not found", nil)
+		apperror.Respond(c, err)
 		return
 	}
 
-	util.Response(c, "user found", 200, user, nil)
+	util.Response(c, "user found", 200, models.NewUserResponse(user), nil)
 }
 
 func (u *HTTPHandler) TransferFunds(c *gin.Context) {
 	//declare request body struct
-	var transferRequest *models.TransferRequest
+	transferRequest := &models.TransferRequest{}
 
 	//bind JSON data to struct
-	if err := c.ShouldBind(&transferRequest); err != nil {
-		util.Response(c, "invalid request", 400, "bad request body", nil)
+	if !bindRequest(c, transferRequest) {
 		return
 	}
 
 	//Get user from context
 	user, err := u.GetUserFromContext(c)
 	if err != nil {
-		util.Response(c, "User not logged in", 500, "user not found", nil)
+		apperror.Respond(c, err)
 		return
 	}
 
 	//validate the amount
-	if transferRequest.Amount <= 0 {
-		util.Response(c, "invalid amount", 400, "invalid amount", nil)
+	amount, err := transferRequest.Money()
+	if err != nil {
+		invalidAmount(c, err)
 		return
 	}
 
 	//check if the account number exist
 	recipient, err := u.Repository.FindUserByAccountNumber(transferRequest.AccountNumber)
+	if errors.Is(err, ports.ErrUserNotFound) {
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeAccountNotFound, "account number does not exist"))
+		return
+	}
 	if err != nil {
-		util.Response(c, "account number does not exist", 400, "account number does not exist", nil)
+		apperror.Respond(c, apperror.Unexpected(err, "transfer failed"))
 		return
 	}
 
-	//check if amount being transferred is less than the user's current balance
-	if user.AvailableBalance < transferRequest.Amount {
-		util.Response(c, "insufficient funds", 400, "insufficient funds", nil)
+	if recipient.ID == user.ID {
+		apperror.Respond(c, apperror.New(apperror.CodeSameAccount, "cannot transfer to your own account"))
 		return
 	}
 
-	//persist the data into the db
-	err = u.Repository.TransferFunds(user, recipient, transferRequest.Amount)
+	if !u.authorizePIN(c, user, transferRequest.PIN) {
+		return
+	}
+
+	//persist the data into the db, the balance is checked against the locked wallet
+	transaction, err := u.Repository.TransferFunds(user, recipient, amount, u.transferFee(amount.Currency))
+	if errors.Is(err, ports.ErrInsufficientFunds) {
+		apperror.Respond(c, err)
+		return
+	}
+	if errors.Is(err, ports.ErrWalletNotFound) {
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeWalletNotFound, "you do not hold a "+amount.Currency+" wallet"))
+		return
+	}
+	if errors.Is(err, ports.ErrCurrencyMismatch) {
+		apperror.Respond(c, apperror.Wrap(err, apperror.CodeCurrencyMismatch, "recipient does not hold a "+amount.Currency+" wallet, request a currency conversion"))
+		return
+	}
 	if err != nil {
-		util.Response(c, "transfer failed", 500, "transfer failed", nil)
+		apperror.Respond(c, apperror.Unexpected(err, "transfer failed"))
 		return
 	}
 
-	util.Response(c, "transfer successful", 200, "transfer successful", nil)
+	util.Response(c, "transfer successful", 200, models.NewTransactionResponse(transaction), nil)
 }
 
 // Add money to user account
 func (u *HTTPHandler) AddMoney(c *gin.Context) {
 	//declare request body struct
-	var transferRequest *models.TransferRequest
+	fundsRequest := &models.AddFundsRequest{}
 
 	//bind JSON data to struct
-	if err := c.ShouldBind(&transferRequest); err != nil {
-		util.Response(c, "invalid request", 400, "bad request body", nil)
+	if !bindRequest(c, fundsRequest) {
 		return
 	}
 
 	//Get user from context
 	user, err := u.GetUserFromContext(c)
 	if err != nil {
-		util.Response(c, "User not logged in", 500, "user not found", nil)
+		apperror.Respond(c, err)
 		return
 	}
 
 	//validate the amount
-	if transferRequest.Amount <= 0 {
-		util.Response(c, "invalid amount", 400, "invalid amount", nil)
+	amount, err := fundsRequest.Money()
+	if err != nil {
+		invalidAmount(c, err)
 		return
 	}
 
-	//add the amount to the user's account
-	user.AvailableBalance += transferRequest.Amount
-
-	//persist the data into the db
-	err = u.Repository.UpdateUser(user)
+	//add the amount to the user's wallet and persist it into the db
+	transaction, err := u.Repository.AddFunds(user, amount)
 	if err != nil {
-		util.Response(c, "add money failed", 500, "add money failed", nil)
+		apperror.Respond(c, apperror.Unexpected(err, "add money failed"))
 		return
 	}
 
-	util.Response(c, "add money successful", 200, "add money successful", nil)
+	util.Response(c, "add money successful", 200, models.NewTransactionResponse(transaction), nil)
 }
 
 func (u *HTTPHandler) BalanceCheck(c *gin.Context) {
@@ -222,11 +256,16 @@ func (u *HTTPHandler) BalanceCheck(c *gin.Context) {
 	// get user from context
 	user, err := u.GetUserFromContext(c)
 	if err != nil {
-		util.Response(c, "user not fount", 500, "user not found", nil)
+		apperror.Respond(c, err)
 		return
 	}
-	// checking balance
-	util.Response(c, "Balance retrieved successfully", 200, gin.H{"balance": user}, nil)
+	// checking balance of every wallet
+	wallets, err := u.Repository.Wallets(user)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not retrieve balance"))
+		return
+	}
+	util.Response(c, "Balance retrieved successfully", 200, gin.H{"balance": models.NewWalletResponses(wallets)}, nil)
 }
 
 // Transaction history
@@ -236,28 +275,43 @@ func (u *HTTPHandler) UserTransactionHistory(c *gin.Context) {
 	// get user from context
 	user, err := u.GetUserFromContext(c)
 	if err != nil {
-		util.Response(c, "user not fount", 500, "user not found", nil)
+		apperror.Respond(c, err)
 		return
 	}
-	// Add/ create a  function to the repository  to retrive the transacton history
-	transaction, err := u.Repository.Transaction(user.AccountNo)
+	filter, errs := transactionFilterFromQuery(c, user.AccountNo)
+	if len(errs) > 0 {
+		util.DetailedResponse(c, "invalid query", 400, nil, errs)
+		return
+	}
+
+	page, err := u.Repository.Transactions(filter)
 	if err != nil {
-		util.Response(c, "count not retrieve trasaction", 500, "not retrieved", nil)
+		apperror.Respond(c, apperror.Unexpected(err, "could not retrieve transactions"))
 		return
 	}
-	util.Response(c, "transaction successfully retrieved", 200, transaction, nil)
+	util.Response(c, "transaction successfully retrieved", 200, models.NewTransactionPageResponse(page), nil)
 }
 
 func (u *HTTPHandler) Dashboard(c *gin.Context) {
 	user, err := u.GetUserFromContext(c)
 	if err != nil {
-		util.Response(c, "user not fount", 500, "user not found", nil)
+		apperror.Respond(c, err)
+		return
+	}
+
+	// only the most recent transactions, the full history is paginated
+	page, err := u.Repository.Transactions(models.TransactionFilter{
+		AccountNo: user.AccountNo,
+		Limit:     dashboardTransactions,
+	})
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not retrieve transactions"))
 		return
 	}
 
-	transaction, err := u.Repository.Transaction(user.AccountNo)
+	wallets, err := u.Repository.Wallets(user)
 	if err != nil {
-		util.Response(c, "count not retrieve trasaction", 500, "not retrieved", nil)
+		apperror.Respond(c, apperror.Unexpected(err, "could not retrieve balance"))
 		return
 	}
 
@@ -265,9 +319,12 @@ func (u *HTTPHandler) Dashboard(c *gin.Context) {
 		FirstName:        user.FirstName,
 		LastName:         user.LastName,
 		Email:            user.Email,
+		EmailVerified:    user.IsEmailVerified(),
+		Phone:            user.Phone,
+		PhoneVerified:    user.IsPhoneVerified(),
 		AccountNo:        user.AccountNo,
-		AvailableBalance: user.AvailableBalance,
-		UserTransactions: transaction,
+		Wallets:          models.NewWalletResponses(wallets),
+		UserTransactions: models.NewTransactionResponses(page.Transactions),
 	}
 
 	util.Response(c, "transaction successfully retrieved", 200, gin.H{"transaction": dashboard}, nil)
@@ -0,0 +1,97 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sendEmailVerification stores the hash of a new verification token and sends the token to the user
+func (u *HTTPHandler) sendEmailVerification(user *models.User) error {
+	token, err := util.GenerateTokenID()
+	if err != nil {
+		return err
+	}
+
+	verification := &models.EmailVerification{
+		UserID:    user.ID,
+		TokenHash: util.HashToken(token),
+		ExpiresAt: time.Now().Add(u.Config.EmailVerificationTTL),
+	}
+	if err := u.Repository.CreateEmailVerification(verification); err != nil {
+		return err
+	}
+
+	body := "Use this token to verify your email: " + token
+	if u.Config.EmailVerificationURL != "" {
+		body = "Verify your email at " + u.Config.EmailVerificationURL + "?token=" + url.QueryEscape(token)
+	}
+	body += "\nIt expires in " + u.Config.EmailVerificationTTL.String() + ". You cannot send or add money until you do."
+
+	return u.Notifier.Notify(models.Notification{
+		To:      user.Email,
+		Subject: "Verify your email",
+		Body:    body,
+	})
+}
+
+// VerifyEmail verifies a user's email with the token sent to it
+func (u *HTTPHandler) VerifyEmail(c *gin.Context) {
+	verifyRequest := &models.VerifyEmailRequest{}
+	if !bindRequest(c, verifyRequest) {
+		return
+	}
+
+	_, err := u.Repository.VerifyEmail(util.HashToken(verifyRequest.Token))
+	if errors.Is(err, ports.ErrVerificationTokenInvalid) {
+		apperror.Respond(c, err)
+		return
+	}
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not verify email"))
+		return
+	}
+	util.Response(c, "email verified", http.StatusOK, "success", nil)
+}
+
+// ResendEmailVerification sends the logged in user a new verification token, at most once per
+// EmailVerificationResendInterval
+func (u *HTTPHandler) ResendEmailVerification(c *gin.Context) {
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	if user.IsEmailVerified() {
+		apperror.Respond(c, apperror.New(apperror.CodeAlreadyVerified, "email already verified"))
+		return
+	}
+
+	lastSent, err := u.Repository.LastEmailVerification(user)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not send verification"))
+		return
+	}
+	if wait := time.Until(lastSent.Add(u.Config.EmailVerificationResendInterval)); wait > 0 {
+		retryAfter := wait.Round(time.Second) + time.Second
+		c.Header("Retry-After", fmt.Sprint(int(retryAfter.Seconds())))
+		apperror.Respond(c, apperror.New(apperror.CodeRateLimited,
+			"a verification was sent recently, try again in "+retryAfter.String()))
+		return
+	}
+
+	if err := u.sendEmailVerification(user); err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "could not send verification"))
+		return
+	}
+	util.Response(c, "verification sent", http.StatusOK, "success", nil)
+}
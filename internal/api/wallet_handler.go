@@ -0,0 +1,31 @@
+package api
+
+import (
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/util"
+
+	"github.com/gin-gonic/gin"
+)
+
+// OpenWallet opens a wallet for the user in another currency
+func (u *HTTPHandler) OpenWallet(c *gin.Context) {
+	walletRequest := &models.OpenWalletRequest{}
+	if !bindRequest(c, walletRequest) {
+		return
+	}
+
+	user, err := u.GetUserFromContext(c)
+	if err != nil {
+		apperror.Respond(c, err)
+		return
+	}
+
+	wallet, err := u.Repository.OpenWallet(user, walletRequest.Currency)
+	if err != nil {
+		apperror.Respond(c, apperror.Unexpected(err, "wallet not opened"))
+		return
+	}
+
+	util.Response(c, "wallet opened", 200, models.NewWalletResponse(wallet), nil)
+}
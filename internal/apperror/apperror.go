@@ -0,0 +1,238 @@
+// Package apperror is the catalogue of errors the API answers with. Every error has a stable,
+// machine-readable code that clients can match on instead of the message, and the code decides
+// the HTTP status.
+package apperror
+
+import (
+	"errors"
+	"log"
+	"payment-system-one/internal/ports"
+	"payment-system-one/internal/util"
+	"sort"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// Code identifies a kind of error. Codes never change once published.
+type Code string
+
+// Error codes, see Catalogue for what they mean
+const (
+	CodeBadRequest               Code = "BAD_REQUEST"
+	CodeUnauthenticated          Code = "UNAUTHENTICATED"
+	CodeInvalidCredentials       Code = "INVALID_CREDENTIALS"
+	CodeInvalidToken             Code = "INVALID_TOKEN"
+	CodeTokenReused              Code = "TOKEN_REUSED"
+	CodeForbidden                Code = "FORBIDDEN"
+	CodeEmailNotVerified         Code = "EMAIL_NOT_VERIFIED"
+	CodeWrongPassword            Code = "WRONG_PASSWORD"
+	CodeWrongMFACode             Code = "WRONG_MFA_CODE"
+	CodeMFAAlreadyEnabled        Code = "MFA_ALREADY_ENABLED"
+	CodeMFANotEnabled            Code = "MFA_NOT_ENABLED"
+	CodePINNotSet                Code = "PIN_NOT_SET"
+	CodeWrongPIN                 Code = "WRONG_PIN"
+	CodePINLocked                Code = "PIN_LOCKED"
+	CodeTooManyAttempts          Code = "TOO_MANY_ATTEMPTS"
+	CodeRateLimited              Code = "RATE_LIMITED"
+	CodeInvalidInvitation        Code = "INVALID_INVITATION"
+	CodeInvalidResetToken        Code = "INVALID_RESET_TOKEN"
+	CodeInvalidVerificationToken Code = "INVALID_VERIFICATION_TOKEN"
+	CodeInvalidOTP               Code = "INVALID_OTP"
+	CodeAlreadyVerified          Code = "ALREADY_VERIFIED"
+	CodeAccountExists            Code = "ACCOUNT_EXISTS"
+	CodeNotFound                 Code = "NOT_FOUND"
+	CodeAccountNotFound          Code = "ACCOUNT_NOT_FOUND"
+	CodeAdminNotFound            Code = "ADMIN_NOT_FOUND"
+	CodeTransactionNotFound      Code = "TRANSACTION_NOT_FOUND"
+	CodeWalletNotFound           Code = "WALLET_NOT_FOUND"
+	CodeExchangeRateNotFound     Code = "EXCHANGE_RATE_NOT_FOUND"
+	CodeQuoteNotFound            Code = "QUOTE_NOT_FOUND"
+	CodeQuoteExpired             Code = "QUOTE_EXPIRED"
+	CodeQuoteUsed                Code = "QUOTE_USED"
+	CodeInsufficientFunds        Code = "INSUFFICIENT_FUNDS"
+	CodeSameAccount              Code = "SAME_ACCOUNT"
+	CodeCurrencyMismatch         Code = "CURRENCY_MISMATCH"
+	CodeNotReversible            Code = "NOT_REVERSIBLE"
+	CodeIllegalTransition        Code = "ILLEGAL_TRANSITION"
+	CodeReversalExceedsAmount    Code = "REVERSAL_EXCEEDS_AMOUNT"
+	CodeIdempotencyKeyInUse      Code = "IDEMPOTENCY_KEY_IN_USE"
+	CodeIdempotencyKeyReused     Code = "IDEMPOTENCY_KEY_REUSED"
+	CodeUpstreamUnavailable      Code = "UPSTREAM_UNAVAILABLE"
+	CodeInternal                 Code = "INTERNAL"
+)
+
+// Entry describes an error code for the API docs
+type Entry struct {
+	Code        Code   `json:"code"`
+	Status      int    `json:"status"`
+	Description string `json:"description"`
+}
+
+var catalogue = map[Code]Entry{
+	CodeBadRequest:               {Status: 400, Description: "A path or query parameter is invalid, or the request cannot be carried out as asked"},
+	CodeUnauthenticated:          {Status: 401, Description: "The access token is missing, invalid, expired or revoked"},
+	CodeInvalidCredentials:       {Status: 401, Description: "The email, password or two-factor code of a login is wrong"},
+	CodeInvalidToken:             {Status: 401, Description: "The refresh or MFA token is invalid or expired"},
+	CodeTokenReused:              {Status: 401, Description: "The refresh token was already used, every session of its family is revoked"},
+	CodeForbidden:                {Status: 403, Description: "The admin's role does not allow this"},
+	CodeEmailNotVerified:         {Status: 403, Description: "The email must be verified before money can move"},
+	CodeWrongPassword:            {Status: 403, Description: "The current password is wrong"},
+	CodeWrongMFACode:             {Status: 403, Description: "The two-factor or recovery code is wrong or already used"},
+	CodeMFAAlreadyEnabled:        {Status: 409, Description: "Two-factor authentication is already enabled"},
+	CodeMFANotEnabled:            {Status: 409, Description: "Two-factor authentication is not enabled"},
+	CodePINNotSet:                {Status: 403, Description: "A transaction PIN must be set before making payments"},
+	CodeWrongPIN:                 {Status: 403, Description: "The transaction PIN is wrong"},
+	CodePINLocked:                {Status: 423, Description: "Too many wrong transaction PINs, PIN use is locked for a while"},
+	CodeTooManyAttempts:          {Status: 429, Description: "Too many failed attempts, try again after Retry-After or ask for a new code"},
+	CodeRateLimited:              {Status: 429, Description: "Asked again too soon, try again after Retry-After"},
+	CodeInvalidInvitation:        {Status: 400, Description: "The admin invitation is invalid, used or expired"},
+	CodeInvalidResetToken:        {Status: 400, Description: "The password reset token is invalid, used or expired"},
+	CodeInvalidVerificationToken: {Status: 400, Description: "The email verification token is invalid, used or expired"},
+	CodeInvalidOTP:               {Status: 400, Description: "The phone verification code is wrong, used or expired"},
+	CodeAlreadyVerified:          {Status: 409, Description: "The email or phone number is already verified"},
+	CodeAccountExists:            {Status: 409, Description: "A user or admin with this email already exists"},
+	CodeNotFound:                 {Status: 404, Description: "The resource does not exist"},
+	CodeAccountNotFound:          {Status: 404, Description: "The user or account number does not exist"},
+	CodeAdminNotFound:            {Status: 404, Description: "The admin does not exist"},
+	CodeTransactionNotFound:      {Status: 404, Description: "The transaction does not exist or is not the user's"},
+	CodeWalletNotFound:           {Status: 404, Description: "The user holds no wallet in this currency"},
+	CodeExchangeRateNotFound:     {Status: 404, Description: "There is no exchange rate for this currency pair"},
+	CodeQuoteNotFound:            {Status: 404, Description: "The quote does not exist or is not the user's"},
+	CodeQuoteExpired:             {Status: 400, Description: "The quote has expired, ask for a new one"},
+	CodeQuoteUsed:                {Status: 409, Description: "The quote has already been used"},
+	CodeInsufficientFunds:        {Status: 400, Description: "The wallet balance does not cover the amount and fee"},
+	CodeSameAccount:              {Status: 400, Description: "Money cannot be sent to the same account"},
+	CodeCurrencyMismatch:         {Status: 400, Description: "The recipient holds no wallet in this currency, convert first"},
+	CodeNotReversible:            {Status: 409, Description: "Transactions of this type cannot be reversed"},
+	CodeIllegalTransition:        {Status: 409, Description: "The transaction cannot move to that status from its current one"},
+	CodeReversalExceedsAmount:    {Status: 400, Description: "The reversal exceeds what is left of the transaction"},
+	CodeIdempotencyKeyInUse:      {Status: 409, Description: "A request with this Idempotency-Key is still in progress"},
+	CodeIdempotencyKeyReused:     {Status: 422, Description: "The Idempotency-Key was used with a different request"},
+	CodeUpstreamUnavailable:      {Status: 502, Description: "A provider such as the SMS sender failed"},
+	CodeInternal:                 {Status: 500, Description: "Something went wrong on our side"},
+}
+
+// Catalogue lists every error code, ordered by status then code
+func Catalogue() []Entry {
+	entries := make([]Entry, 0, len(catalogue))
+	for code, entry := range catalogue {
+		entry.Code = code
+		entries = append(entries, entry)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Status != entries[j].Status {
+			return entries[i].Status < entries[j].Status
+		}
+		return entries[i].Code < entries[j].Code
+	})
+	return entries
+}
+
+// Error is an error the API answers with. Message is shown to clients, the cause Err is only logged.
+type Error struct {
+	Code    Code
+	Message string
+	Err     error
+}
+
+// New returns an error with a code and a message for clients
+func New(code Code, message string) *Error {
+	return &Error{Code: code, Message: message}
+}
+
+// Wrap returns an error with a code and a message for clients, caused by err
+func Wrap(err error, code Code, message string) *Error {
+	return &Error{Code: code, Message: message, Err: err}
+}
+
+func (e *Error) Error() string {
+	if e.Err != nil {
+		return e.Message + ": " + e.Err.Error()
+	}
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// Status is the HTTP status of the error's code
+func (e *Error) Status() int {
+	if entry, ok := catalogue[e.Code]; ok {
+		return entry.Status
+	}
+	return 500
+}
+
+// domainErrors are the codes of the errors repositories return
+var domainErrors = map[error]Code{
+	ports.ErrInsufficientFunds:        CodeInsufficientFunds,
+	ports.ErrSameAccount:              CodeSameAccount,
+	ports.ErrCurrencyMismatch:         CodeCurrencyMismatch,
+	ports.ErrWalletNotFound:           CodeWalletNotFound,
+	ports.ErrQuoteNotFound:            CodeQuoteNotFound,
+	ports.ErrQuoteExpired:             CodeQuoteExpired,
+	ports.ErrQuoteUsed:                CodeQuoteUsed,
+	ports.ErrIllegalTransition:        CodeIllegalTransition,
+	ports.ErrNotReversible:            CodeNotReversible,
+	ports.ErrReversalExceedsAmount:    CodeReversalExceedsAmount,
+	ports.ErrInvitationInvalid:        CodeInvalidInvitation,
+	ports.ErrAdminExists:              CodeAccountExists,
+	ports.ErrRefreshTokenInvalid:      CodeInvalidToken,
+	ports.ErrRefreshTokenReused:       CodeTokenReused,
+	ports.ErrTOTPCodeUsed:             CodeWrongMFACode,
+	ports.ErrRecoveryCodeInvalid:      CodeWrongMFACode,
+	ports.ErrAccountNotFound:          CodeAccountNotFound,
+	ports.ErrUserNotFound:             CodeAccountNotFound,
+	ports.ErrAdminNotFound:            CodeAdminNotFound,
+	ports.ErrTransactionNotFound:      CodeTransactionNotFound,
+	ports.ErrExchangeRateNotFound:     CodeExchangeRateNotFound,
+	ports.ErrResetTokenInvalid:        CodeInvalidResetToken,
+	ports.ErrVerificationTokenInvalid: CodeInvalidVerificationToken,
+	ports.ErrPhoneOTPInvalid:          CodeInvalidOTP,
+	ports.ErrPhoneOTPAttemptsExceeded: CodeTooManyAttempts,
+	ports.ErrPINLocked:                CodePINLocked,
+	ports.ErrLoginLocked:              CodeTooManyAttempts,
+	ports.ErrSendThrottled:            CodeRateLimited,
+	gorm.ErrRecordNotFound:            CodeNotFound,
+}
+
+// From returns err as an *Error: itself if it is one, the code of a repository error with its
+// message, or an internal error
+func From(err error) *Error {
+	return Unexpected(err, "internal server error")
+}
+
+// Unexpected is like From, but an error that is neither an *Error nor a repository error becomes
+// an internal error with message
+func Unexpected(err error, message string) *Error {
+	var appErr *Error
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	for domainErr, code := range domainErrors {
+		if errors.Is(err, domainErr) {
+			return Wrap(err, code, domainErr.Error())
+		}
+	}
+	return Wrap(err, CodeInternal, message)
+}
+
+// Respond answers with err, converted by From. Internal errors are logged with their cause.
+func Respond(c *gin.Context, err error) {
+	appErr := From(err)
+	if appErr.Code == CodeInternal {
+		log.Printf("%s %s: %v\n", c.Request.Method, c.FullPath(), appErr)
+	}
+	util.DetailedResponse(c, appErr.Message, appErr.Status(), nil, []util.ErrorDetail{{
+		Code:    string(appErr.Code),
+		Message: appErr.Message,
+	}})
+}
+
+// Abort answers with err like Respond and stops the handlers after the current one
+func Abort(c *gin.Context, err error) {
+	Respond(c, err)
+	c.Abort()
+}
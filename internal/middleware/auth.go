@@ -1,48 +1,153 @@
 package middleware
 
 import (
+	"errors"
 	"github.com/gin-gonic/gin"
 	"log"
-	"net/http"
-	"os"
+	"payment-system-one/internal/apperror"
 	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
 )
 
-func AuthorizeAdmin(findUserByEmail func(string) (*models.User, error), tokenInBlacklist func(*string) bool) gin.HandlerFunc {
+// errUnauthenticated answers requests without a valid access token of a current account
+var errUnauthenticated = apperror.New(apperror.CodeUnauthenticated, "not logged in")
+
+// authorizeToken verifies the access token in the header, which must have been issued for
+// audience so a user token cannot be used on admin routes or the other way round, and rejects
+// it if it has been revoked or the revocation cannot be checked. It puts the token and its id and expiry in the context and
+// returns the email it was issued to, or responds and aborts.
+func authorizeToken(c *gin.Context, keys *KeySet, audience string, tokenInBlacklist func(string) (bool, error)) (string, bool) {
+	accToken := GetTokenFromHeader(c)
+	accessToken, accessClaims, err := AuthorizeToken(&accToken, keys, audience)
+	if err != nil {
+		log.Printf("authorize access token errors: %s\n", err.Error())
+		apperror.Abort(c, errUnauthenticated)
+		return "", false
+	}
+
+	if accessClaims["token_use"] != TokenUseAccess {
+		log.Printf("token is not an access token\n")
+		apperror.Abort(c, errUnauthenticated)
+		return "", false
+	}
+
+	tokenID, _ := accessClaims["jti"].(string)
+	if tokenID == "" {
+		log.Printf("access token has no id\n")
+		apperror.Abort(c, errUnauthenticated)
+		return "", false
+	}
+	// revocation fails closed: a token is refused when the blacklist cannot be checked
+	revoked, err := tokenInBlacklist(tokenID)
+	if err != nil {
+		apperror.Abort(c, err)
+		return "", false
+	}
+	if revoked {
+		log.Printf("access token is revoked\n")
+		apperror.Abort(c, errUnauthenticated)
+		return "", false
+	}
+
+	email, ok := accessClaims["user_email"].(string)
+	if !ok {
+		log.Printf("user email is not string\n")
+		apperror.Abort(c, apperror.New(apperror.CodeInternal, "internal server error"))
+		return "", false
+	}
+
+	// set the token, its id and its expiry as context parameters.
+	c.Set("access_token", accessToken.Raw)
+	c.Set("access_token_id", tokenID)
+	expiresAt, _ := accessClaims.GetExpirationTime()
+	c.Set("access_token_expires_at", expiresAt.Time)
+	return email, true
+}
+
+// AuthorizeUser lets requests with a user access token through, putting the user in the context
+func AuthorizeUser(keys *KeySet, findUserByEmail func(string) (*models.User, error), tokenInBlacklist func(string) (bool, error)) gin.HandlerFunc {
 	return func(c *gin.Context) {
+		email, ok := authorizeToken(c, keys, AudienceUser, tokenInBlacklist)
+		if !ok {
+			return
+		}
 
-		var user *models.User
-		var errors error
-		secret := os.Getenv("JWT_SECRET")
-		accToken := GetTokenFromHeader(c)
-		accessToken, accessClaims, err := AuthorizeToken(&accToken, &secret)
+		user, err := findUserByEmail(email)
 		if err != nil {
-			log.Printf("authorize access token errors: %s\n", err.Error())
-			RespondAndAbort(c, "", http.StatusUnauthorized, nil, []string{"unauthorized"})
+			if errors.Is(err, ports.ErrUserNotFound) {
+				err = errUnauthenticated
+			}
+			apperror.Abort(c, err)
 			return
 		}
 
-		//if tokenInBlacklist(&accessToken.Raw) || IsTokenExpired(accessClaims) {
-		//	c.AbortWithStatusJSON(http.StatusBadRequest, "unauthorized route ")
-		//}
+		// set the user as a context parameter.
+		c.Set("user", user)
+
+		// calling next handler
+		c.Next()
+	}
+}
+
+// AuthorizeAdmin lets requests with an admin access token through, putting the admin in the context
+func AuthorizeAdmin(keys *KeySet, findAdminByEmail func(string) (*models.Admin, error), tokenInBlacklist func(string) (bool, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		email, ok := authorizeToken(c, keys, AudienceAdmin, tokenInBlacklist)
+		if !ok {
+			return
+		}
 
-		if email, ok := accessClaims["user_email"].(string); ok {
-			if user, errors = findUserByEmail(email); errors != nil {
-				log.Printf("find user by email errors: %v\n", err)
-				RespondAndAbort(c, "", http.StatusNotFound, nil, []string{"user not found"})
-				return
+		admin, err := findAdminByEmail(email)
+		if err != nil {
+			if errors.Is(err, ports.ErrAdminNotFound) {
+				err = errUnauthenticated
 			}
-		} else {
-			log.Printf("user email is not string\n")
-			RespondAndAbort(c, "", http.StatusInternalServerError, nil, []string{"internal server errors"})
+			apperror.Abort(c, err)
 			return
 		}
 
-		// set the user and token as context parameters.
-		c.Set("user", user)
-		c.Set("access_token", accessToken.Raw)
+		// set the admin as a context parameter.
+		c.Set("admin", admin)
 
 		// calling next handler
 		c.Next()
 	}
 }
+
+// RequirePermission only lets admins whose role grants permission through. It must run after AuthorizeAdmin.
+func RequirePermission(permission string) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contextAdmin, _ := c.Get("admin")
+		admin, ok := contextAdmin.(*models.Admin)
+		if !ok {
+			apperror.Abort(c, errUnauthenticated)
+			return
+		}
+
+		if !admin.HasPermission(permission) {
+			apperror.Abort(c, apperror.New(apperror.CodeForbidden, "your role does not allow this"))
+			return
+		}
+
+		c.Next()
+	}
+}
+
+// RequireVerifiedEmail only lets users who verified their email through. It must run after AuthorizeUser.
+func RequireVerifiedEmail() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contextUser, _ := c.Get("user")
+		user, ok := contextUser.(*models.User)
+		if !ok {
+			apperror.Abort(c, errUnauthenticated)
+			return
+		}
+
+		if !user.IsEmailVerified() {
+			apperror.Abort(c, apperror.New(apperror.CodeEmailNotVerified, "verify your email before moving money"))
+			return
+		}
+
+		c.Next()
+	}
+}
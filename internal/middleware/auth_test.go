@@ -0,0 +1,115 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/x509"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"payment-system-one/internal/models"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testIssuer    = "test-issuer"
+	testClockSkew = 30 * time.Second
+)
+
+// testKeySet loads a key set holding one fresh Ed25519 key, kid "test", from a temporary directory
+func testKeySet(t *testing.T) *KeySet {
+	t.Helper()
+	_, private, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generate key: %v", err)
+	}
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		t.Fatalf("marshal key: %v", err)
+	}
+	dir := t.TempDir()
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der})
+	if err := os.WriteFile(filepath.Join(dir, "test.pem"), data, 0o600); err != nil {
+		t.Fatalf("write key: %v", err)
+	}
+	keys, err := LoadKeySet(dir, "test", testIssuer, testClockSkew)
+	if err != nil {
+		t.Fatalf("load key set: %v", err)
+	}
+	return keys
+}
+
+// accessToken signs a user access token for email
+func accessToken(t *testing.T, keys *KeySet, email string) string {
+	t.Helper()
+	token, err := keys.Sign(jwt.MapClaims{
+		"jti":        "access-token-id",
+		"user_email": email,
+		"aud":        AudienceUser,
+		"exp":        time.Now().Add(time.Hour).Unix(),
+		"token_use":  TokenUseAccess,
+	})
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return token
+}
+
+func TestAuthorizeUserBlacklist(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	keys := testKeySet(t)
+	findUser := func(email string) (*models.User, error) {
+		return &models.User{Email: email}, nil
+	}
+
+	tests := []struct {
+		name       string
+		blacklist  func(string) (bool, error)
+		wantStatus int
+		wantCode   string
+	}{
+		{"not revoked", func(string) (bool, error) { return false, nil }, http.StatusOK, ""},
+		{"revoked", func(string) (bool, error) { return true, nil }, http.StatusUnauthorized, "UNAUTHENTICATED"},
+		{"blacklist unavailable", func(string) (bool, error) { return false, errors.New("connection refused") },
+			http.StatusInternalServerError, "INTERNAL"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			router := gin.New()
+			router.GET("/", AuthorizeUser(keys, findUser, test.blacklist), func(c *gin.Context) {
+				c.Status(http.StatusOK)
+			})
+
+			request := httptest.NewRequest(http.MethodGet, "/", nil)
+			request.Header.Set("Authorization", "Bearer "+accessToken(t, keys, "ada@example.com"))
+			recorder := httptest.NewRecorder()
+			router.ServeHTTP(recorder, request)
+
+			if recorder.Code != test.wantStatus {
+				t.Fatalf("status = %d, want %d", recorder.Code, test.wantStatus)
+			}
+			if test.wantCode == "" {
+				return
+			}
+			body := struct {
+				Errors []struct {
+					Code string `json:"code"`
+				} `json:"errors"`
+			}{}
+			if err := json.Unmarshal(recorder.Body.Bytes(), &body); err != nil {
+				t.Fatalf("decode body: %v", err)
+			}
+			if len(body.Errors) != 1 || body.Errors[0].Code != test.wantCode {
+				t.Errorf("errors = %+v, want code %s", body.Errors, test.wantCode)
+			}
+		})
+	}
+}
@@ -0,0 +1,133 @@
+package middleware
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"log"
+	"net/http"
+	"payment-system-one/internal/apperror"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// IdempotencyKeyHeader is the request header clients put a unique key per operation in
+const IdempotencyKeyHeader = "Idempotency-Key"
+
+// maxIdempotencyKeyLength bounds the keys we store
+const maxIdempotencyKeyLength = 255
+
+// responseRecorder keeps a copy of everything written to the response
+type responseRecorder struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (r *responseRecorder) Write(data []byte) (int, error) {
+	r.body.Write(data)
+	return r.ResponseWriter.Write(data)
+}
+
+func (r *responseRecorder) WriteString(s string) (int, error) {
+	r.body.WriteString(s)
+	return r.ResponseWriter.WriteString(s)
+}
+
+// Idempotency makes a route safe to retry. A request carrying an Idempotency-Key header is
+// run once; repeating it with the same key and body replays the stored response, repeating
+// it with a different body is rejected with 422, and repeating it while the first is still
+// running is rejected with 409. A request that has not finished after inProgressTimeout, for
+// instance because the server stopped, gives up the key to a retry. Keys are kept for window.
+// Requests without the header pass through. It must run after the user has been put in the context.
+func Idempotency(store ports.IdempotencyStore, window, inProgressTimeout time.Duration) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		idempotencyKey := c.GetHeader(IdempotencyKeyHeader)
+		if idempotencyKey == "" {
+			c.Next()
+			return
+		}
+		if len(idempotencyKey) > maxIdempotencyKeyLength {
+			apperror.Abort(c, apperror.New(apperror.CodeBadRequest, "idempotency key is too long"))
+			return
+		}
+
+		contextUser, _ := c.Get("user")
+		user, ok := contextUser.(*models.User)
+		if !ok {
+			apperror.Abort(c, apperror.New(apperror.CodeInternal, "internal server error"))
+			return
+		}
+
+		body, err := io.ReadAll(c.Request.Body)
+		if err != nil {
+			apperror.Abort(c, apperror.Wrap(err, apperror.CodeBadRequest, "could not read request body"))
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		hash := sha256.New()
+		hash.Write([]byte(c.Request.Method + " " + c.Request.URL.Path + "\n"))
+		hash.Write(body)
+
+		now := time.Now()
+		record := &models.IdempotencyKey{
+			UserID:        user.ID,
+			Key:           idempotencyKey,
+			RequestHash:   hex.EncodeToString(hash.Sum(nil)),
+			ReservedUntil: now.Add(inProgressTimeout),
+			ExpiresAt:     now.Add(window),
+		}
+		stored, created, err := store.ReserveIdempotencyKey(record)
+		if err != nil {
+			apperror.Abort(c, apperror.Wrap(err, apperror.CodeInternal, "internal server error"))
+			return
+		}
+
+		if !created {
+			switch {
+			case stored.RequestHash != record.RequestHash:
+				apperror.Abort(c, apperror.New(apperror.CodeIdempotencyKeyReused, "idempotency key was used with a different request"))
+			case !stored.Completed:
+				apperror.Abort(c, apperror.New(apperror.CodeIdempotencyKeyInUse, "a request with this idempotency key is in progress"))
+			default:
+				c.Header("Idempotent-Replayed", "true")
+				c.Data(stored.StatusCode, "application/json; charset=utf-8", stored.ResponseBody)
+				c.Abort()
+			}
+			return
+		}
+
+		// a handler that panics must not hold the key until it times out
+		finished := false
+		defer func() {
+			if !finished {
+				if err := store.ReleaseIdempotencyKey(stored); err != nil {
+					log.Printf("release idempotency key errors: %v\n", err)
+				}
+			}
+		}()
+
+		recorder := &responseRecorder{ResponseWriter: c.Writer}
+		c.Writer = recorder
+		c.Next()
+		finished = true
+
+		// server errors are not stored so the client can retry them
+		if recorder.Status() >= http.StatusInternalServerError {
+			if err := store.ReleaseIdempotencyKey(stored); err != nil {
+				log.Printf("release idempotency key errors: %v\n", err)
+			}
+			return
+		}
+
+		stored.StatusCode = recorder.Status()
+		stored.ResponseBody = recorder.body.Bytes()
+		if err := store.CompleteIdempotencyKey(stored); err != nil {
+			log.Printf("complete idempotency key errors: %v\n", err)
+		}
+	}
+}
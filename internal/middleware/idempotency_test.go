@@ -0,0 +1,85 @@
+package middleware
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"payment-system-one/internal/models"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"gorm.io/gorm"
+)
+
+// memoryIdempotencyStore keeps idempotency keys in a map, one per key string
+type memoryIdempotencyStore struct {
+	keys     map[string]*models.IdempotencyKey
+	released int
+}
+
+func (s *memoryIdempotencyStore) ReserveIdempotencyKey(key *models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	if existing, ok := s.keys[key.Key]; ok {
+		return existing, false, nil
+	}
+	s.keys[key.Key] = key
+	return key, true, nil
+}
+
+func (s *memoryIdempotencyStore) CompleteIdempotencyKey(key *models.IdempotencyKey) error {
+	key.Completed = true
+	return nil
+}
+
+func (s *memoryIdempotencyStore) ReleaseIdempotencyKey(key *models.IdempotencyKey) error {
+	delete(s.keys, key.Key)
+	s.released++
+	return nil
+}
+
+func (s *memoryIdempotencyStore) PruneIdempotencyKeys() (int64, error) { return 0, nil }
+
+func TestIdempotencyReleasesKeyWhenHandlerPanics(t *testing.T) {
+	store := &memoryIdempotencyStore{keys: map[string]*models.IdempotencyKey{}}
+	calls := 0
+
+	router := gin.New()
+	router.Use(gin.CustomRecoveryWithWriter(io.Discard, func(c *gin.Context, _ interface{}) {
+		c.AbortWithStatus(http.StatusInternalServerError)
+	}))
+	router.Use(func(c *gin.Context) {
+		c.Set("user", &models.User{Model: gorm.Model{ID: 1}})
+	})
+	router.POST("/transfer", Idempotency(store, time.Hour, time.Minute), func(c *gin.Context) {
+		calls++
+		if calls == 1 {
+			panic("lost the database connection")
+		}
+		c.JSON(http.StatusOK, gin.H{"call": calls})
+	})
+
+	send := func() *httptest.ResponseRecorder {
+		recorder := httptest.NewRecorder()
+		request := httptest.NewRequest(http.MethodPost, "/transfer", strings.NewReader(`{"amount":"10"}`))
+		request.Header.Set(IdempotencyKeyHeader, "key-1")
+		router.ServeHTTP(recorder, request)
+		return recorder
+	}
+
+	if recorder := send(); recorder.Code != http.StatusInternalServerError {
+		t.Fatalf("panicking request answered %d, want 500", recorder.Code)
+	}
+	if store.released != 1 {
+		t.Fatalf("key was released %d times after a panic, want once", store.released)
+	}
+
+	if recorder := send(); recorder.Code != http.StatusOK {
+		t.Fatalf("retry answered %d: %s", recorder.Code, recorder.Body.String())
+	}
+	replayed := send()
+	if replayed.Code != http.StatusOK || replayed.Header().Get("Idempotent-Replayed") != "true" || calls != 2 {
+		t.Errorf("second retry answered %d, replayed %q, handler ran %d times",
+			replayed.Code, replayed.Header().Get("Idempotent-Replayed"), calls)
+	}
+}
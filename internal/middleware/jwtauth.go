@@ -2,43 +2,81 @@ package middleware
 
 import (
 	"fmt"
-	"github.com/dgrijalva/jwt-go"
 	"github.com/gin-gonic/gin"
+	"github.com/golang-jwt/jwt/v5"
 	"log"
-	"payment-system-one/internal/util"
+	"payment-system-one/internal/models"
+	"strconv"
 	"time"
 )
 
 const AccessTokenValidity = time.Hour * 24
-const RefreshTokenValidity = time.Hour * 24
+const RefreshTokenValidity = time.Hour * 24 * 7
+const MFATokenValidity = time.Minute * 5
 
-type Claims struct {
-	UserEmail string `json:"email"`
-	jwt.StandardClaims
-}
+// Token audiences, telling user tokens and admin tokens apart
+const (
+	AudienceUser            = models.AudienceUser
+	AudienceAdmin           = models.AudienceAdmin
+	AudienceAdminInvitation = "admin_invitation"
+	AudienceMFA             = "mfa"
+)
 
-func GenerateClaims(email string) (jwt.MapClaims, jwt.MapClaims) {
+// Token uses, telling access tokens and refresh tokens of the same audience apart
+const (
+	TokenUseAccess  = "access"
+	TokenUseRefresh = "refresh"
+)
+
+// GenerateClaims returns the claims of an access token for email and of the refresh token
+// persisted as refreshToken, which is bound to the user or admin it was issued to and
+// records the id and expiry of the access token
+func GenerateClaims(email string, refreshToken *models.RefreshToken) (jwt.MapClaims, jwt.MapClaims) {
 	log.Println("generate  claim function", email)
 	accessClaims := jwt.MapClaims{
+		"jti":        refreshToken.AccessTokenID,
 		"user_email": email,
-		"exp":        time.Now().Add(AccessTokenValidity).Unix(),
+		"aud":        refreshToken.Audience,
+		"exp":        refreshToken.AccessExpiresAt.Unix(),
+		"token_use":  TokenUseAccess,
 	}
 
 	refreshClaims := jwt.MapClaims{
-		"exp": time.Now().Add(RefreshTokenValidity).Unix(),
-		"sub": 1,
+		"jti":       refreshToken.TokenID,
+		"aud":       refreshToken.Audience,
+		"exp":       refreshToken.ExpiresAt.Unix(),
+		"sub":       strconv.FormatUint(uint64(refreshToken.SubjectID), 10),
+		"token_use": TokenUseRefresh,
 	}
 
 	return accessClaims, refreshClaims
 }
 
-// GenerateToken generates only an access token
-func GenerateToken(signMethod *jwt.SigningMethodHMAC, claims jwt.MapClaims, secret *string) (*string, error) {
-	// Create a new token object, specifying signing method and the claims
-	// you would like it to contain.
-	token := jwt.NewWithClaims(signMethod, claims)
-	// Sign and get the complete encoded token as a string using the secret
-	tokenString, err := token.SignedString([]byte(*secret))
+// GenerateInvitationClaims returns the claims of an admin invitation token
+func GenerateInvitationClaims(tokenID string, email string, expiresAt time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"jti":        tokenID,
+		"user_email": email,
+		"aud":        AudienceAdminInvitation,
+		"exp":        expiresAt.Unix(),
+	}
+}
+
+// GenerateMFAClaims returns the claims of an MFA-pending token, issued after the password check
+// to the user or admin subjectID (told apart by audience) who still has to pass the second factor
+func GenerateMFAClaims(tokenID string, audience string, subjectID uint) jwt.MapClaims {
+	return jwt.MapClaims{
+		"jti":          tokenID,
+		"aud":          AudienceMFA,
+		"sub":          strconv.FormatUint(uint64(subjectID), 10),
+		"subject_type": audience,
+		"exp":          time.Now().Add(MFATokenValidity).Unix(),
+	}
+}
+
+// GenerateToken signs claims with the signing key of keys
+func GenerateToken(keys *KeySet, claims jwt.MapClaims) (*string, error) {
+	tokenString, err := keys.Sign(claims)
 	if err != nil {
 		return nil, err
 	}
@@ -54,39 +92,29 @@ func GetTokenFromHeader(c *gin.Context) string {
 	return ""
 }
 
-// verifyAccessToken verifies a token
-func verifyToken(tokenString *string, claims jwt.MapClaims, secret *string) (*jwt.Token, error) {
-	parser := &jwt.Parser{SkipClaimsValidation: true}
-	return parser.ParseWithClaims(*tokenString, claims, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(*secret), nil
-	})
-}
-
-// AuthorizeToken check if a refresh token is valid
-func AuthorizeToken(token *string, secret *string) (*jwt.Token, jwt.MapClaims, error) {
-	if token != nil && *token != "" && secret != nil && *secret != "" {
-		claims := jwt.MapClaims{}
-		token, err := verifyToken(token, claims, secret)
-		if err != nil {
-			return nil, nil, err
-		}
-		return token, claims, nil
+// AuthorizeToken verifies a token's signature and claims. The token must be signed by one of
+// keys with the algorithm of that key, be issued by keys.Issuer for one of audiences, carry
+// exp and iat, and be within its exp and nbf, allowing keys.Leeway of clock skew.
+func AuthorizeToken(token *string, keys *KeySet, audiences ...string) (*jwt.Token, jwt.MapClaims, error) {
+	if token == nil || *token == "" || keys == nil {
+		return nil, nil, fmt.Errorf("empty token or keys")
 	}
-	return nil, nil, fmt.Errorf("empty token or secret")
-}
 
-// IsTokenExpired checks if token has expired
-func IsTokenExpired(claims jwt.MapClaims) bool {
-	if exp, ok := claims["exp"].(float64); ok {
-		return float64(time.Now().Unix()) > exp
+	parser := jwt.NewParser(
+		jwt.WithValidMethods(keys.methods()),
+		jwt.WithIssuer(keys.Issuer),
+		jwt.WithAudience(audiences...),
+		jwt.WithLeeway(keys.Leeway),
+		jwt.WithExpirationRequired(),
+		jwt.WithIssuedAt(),
+	)
+	claims := jwt.MapClaims{}
+	parsed, err := parser.ParseWithClaims(*token, claims, keys.verificationKey)
+	if err != nil {
+		return nil, nil, err
 	}
-	return true
-}
-
-func RespondAndAbort(c *gin.Context, message string, status int, data interface{}, errs []string) {
-	util.Response(c, message, status, data, errs)
-	c.Abort()
+	if claims["iat"] == nil {
+		return nil, nil, fmt.Errorf("token has no issued at time")
+	}
+	return parsed, claims, nil
 }
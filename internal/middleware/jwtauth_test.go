@@ -0,0 +1,186 @@
+package middleware
+
+import (
+	"crypto/ed25519"
+	"encoding/base64"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// userClaims returns the claims of a valid user access token, as signed by KeySet.Sign
+func userClaims(now time.Time) jwt.MapClaims {
+	return jwt.MapClaims{
+		"jti":        "token-id",
+		"user_email": "ada@example.com",
+		"aud":        AudienceUser,
+		"iss":        testIssuer,
+		"iat":        now.Unix(),
+		"exp":        now.Add(time.Hour).Unix(),
+		"token_use":  TokenUseAccess,
+	}
+}
+
+// signWithKey signs claims as they are with the test key, without stamping iss and iat
+func signWithKey(t *testing.T, keys *KeySet, claims jwt.MapClaims) string {
+	t.Helper()
+	signing := keys.keys["test"]
+	token := jwt.NewWithClaims(signing.method, claims)
+	token.Header["kid"] = signing.id
+	signed, err := token.SignedString(signing.private)
+	if err != nil {
+		t.Fatalf("sign token: %v", err)
+	}
+	return signed
+}
+
+func TestAuthorizeToken(t *testing.T) {
+	keys := testKeySet(t)
+	now := time.Now()
+	skew := int64(testClockSkew / time.Second)
+
+	tests := []struct {
+		name   string
+		token  func() string
+		accept bool
+	}{
+		{"valid", func() string {
+			return signWithKey(t, keys, userClaims(now))
+		}, true},
+		{"signed by the key set", func() string {
+			claims := userClaims(now)
+			delete(claims, "iss")
+			delete(claims, "iat")
+			token, err := keys.Sign(claims)
+			if err != nil {
+				t.Fatalf("sign token: %v", err)
+			}
+			return token
+		}, true},
+		{"expired", func() string {
+			claims := userClaims(now)
+			claims["exp"] = now.Unix() - 2*skew
+			return signWithKey(t, keys, claims)
+		}, false},
+		{"expired within the clock skew", func() string {
+			claims := userClaims(now)
+			claims["exp"] = now.Unix() - skew/2
+			return signWithKey(t, keys, claims)
+		}, true},
+		{"not yet valid", func() string {
+			claims := userClaims(now)
+			claims["nbf"] = now.Unix() + 2*skew
+			return signWithKey(t, keys, claims)
+		}, false},
+		{"not yet valid within the clock skew", func() string {
+			claims := userClaims(now)
+			claims["nbf"] = now.Unix() + skew/2
+			return signWithKey(t, keys, claims)
+		}, true},
+		{"without exp", func() string {
+			claims := userClaims(now)
+			delete(claims, "exp")
+			return signWithKey(t, keys, claims)
+		}, false},
+		{"without iat", func() string {
+			claims := userClaims(now)
+			delete(claims, "iat")
+			return signWithKey(t, keys, claims)
+		}, false},
+		{"issued in the future", func() string {
+			claims := userClaims(now)
+			claims["iat"] = now.Unix() + 2*skew
+			return signWithKey(t, keys, claims)
+		}, false},
+		{"wrong issuer", func() string {
+			claims := userClaims(now)
+			claims["iss"] = "someone-else"
+			return signWithKey(t, keys, claims)
+		}, false},
+		{"admin audience", func() string {
+			claims := userClaims(now)
+			claims["aud"] = AudienceAdmin
+			return signWithKey(t, keys, claims)
+		}, false},
+		{"tampered signature", func() string {
+			parts := strings.Split(signWithKey(t, keys, userClaims(now)), ".")
+			signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+			if err != nil {
+				t.Fatalf("decode signature: %v", err)
+			}
+			signature[0] ^= 0x01
+			parts[2] = base64.RawURLEncoding.EncodeToString(signature)
+			return strings.Join(parts, ".")
+		}, false},
+		{"tampered claims", func() string {
+			parts := strings.Split(signWithKey(t, keys, userClaims(now)), ".")
+			claims := userClaims(now)
+			claims["user_email"] = "mallory@example.com"
+			forged := jwt.NewWithClaims(jwt.SigningMethodEdDSA, claims)
+			payload, err := forged.SigningString()
+			if err != nil {
+				t.Fatalf("encode claims: %v", err)
+			}
+			parts[1] = strings.Split(payload, ".")[1]
+			return strings.Join(parts, ".")
+		}, false},
+		{"HS256 with the public key as secret", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodHS256, userClaims(now))
+			token.Header["kid"] = "test"
+			signed, err := token.SignedString([]byte(keys.keys["test"].public.(ed25519.PublicKey)))
+			if err != nil {
+				t.Fatalf("sign token: %v", err)
+			}
+			return signed
+		}, false},
+		{"alg none", func() string {
+			token := jwt.NewWithClaims(jwt.SigningMethodNone, userClaims(now))
+			token.Header["kid"] = "test"
+			signed, err := token.SignedString(jwt.UnsafeAllowNoneSignatureType)
+			if err != nil {
+				t.Fatalf("sign token: %v", err)
+			}
+			return signed
+		}, false},
+		{"unknown kid", func() string {
+			signing := keys.keys["test"]
+			token := jwt.NewWithClaims(signing.method, userClaims(now))
+			token.Header["kid"] = "retired"
+			signed, err := token.SignedString(signing.private)
+			if err != nil {
+				t.Fatalf("sign token: %v", err)
+			}
+			return signed
+		}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			token := test.token()
+			_, claims, err := AuthorizeToken(&token, keys, AudienceUser)
+			if test.accept && err != nil {
+				t.Fatalf("token rejected: %v", err)
+			}
+			if !test.accept && err == nil {
+				t.Fatalf("token accepted with claims %v", claims)
+			}
+		})
+	}
+}
+
+func TestAuthorizeTokenAudiences(t *testing.T) {
+	keys := testKeySet(t)
+	token := signWithKey(t, keys, userClaims(time.Now()))
+
+	if _, _, err := AuthorizeToken(&token, keys, AudienceAdmin); err == nil {
+		t.Error("user token accepted for the admin audience")
+	}
+	if _, _, err := AuthorizeToken(&token, keys, AudienceAdmin, AudienceUser); err != nil {
+		t.Errorf("user token rejected when the user audience is allowed: %v", err)
+	}
+	empty := ""
+	if _, _, err := AuthorizeToken(&empty, keys, AudienceUser); err == nil {
+		t.Error("empty token accepted")
+	}
+}
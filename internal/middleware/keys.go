@@ -0,0 +1,201 @@
+package middleware
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// minRSAKeyBits is the smallest RSA key accepted for signing or verifying tokens
+const minRSAKeyBits = 2048
+
+// KeySet signs tokens with one private key and verifies them against every loaded key, picked
+// by the kid header. Keeping the previous keys around lets the signing key be rotated without
+// invalidating the tokens it already signed.
+type KeySet struct {
+	// Issuer is stamped on every token signed and required of every token verified
+	Issuer string
+	// Leeway is the clock skew tolerated when checking exp, nbf and iat
+	Leeway time.Duration
+
+	signingKeyID string
+	keys         map[string]*key
+}
+
+type key struct {
+	id      string
+	method  jwt.SigningMethod
+	private crypto.Signer
+	public  crypto.PublicKey
+}
+
+// JSONWebKey is the public part of a verification key, as published in the JWKS document
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`
+	E         string `json:"e,omitempty"`
+	Curve     string `json:"crv,omitempty"`
+	X         string `json:"x,omitempty"`
+}
+
+// JSONWebKeySet is the document served at /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
+// LoadKeySet loads every PEM file in dir as a key whose kid is the file name without its
+// extension. Files may hold RSA (RS256) or Ed25519 (EdDSA) keys, private or public. The key
+// signingKeyID signs new tokens and must be a private key; every key verifies tokens.
+func LoadKeySet(dir string, signingKeyID string, issuer string, leeway time.Duration) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	keySet := &KeySet{Issuer: issuer, Leeway: leeway, signingKeyID: signingKeyID, keys: map[string]*key{}}
+	for _, path := range paths {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		k, err := parseKey(data)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		k.id = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+		keySet.keys[k.id] = k
+	}
+
+	signing, ok := keySet.keys[signingKeyID]
+	if !ok {
+		return nil, fmt.Errorf("signing key %q not found in %s", signingKeyID, dir)
+	}
+	if signing.private == nil {
+		return nil, fmt.Errorf("signing key %q is not a private key", signingKeyID)
+	}
+	return keySet, nil
+}
+
+// parseKey parses a PKCS#8 or PKCS#1 private key or a PKIX public key
+func parseKey(data []byte) (*key, error) {
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("no PEM data")
+	}
+
+	k := &key{}
+	switch block.Type {
+	case "PRIVATE KEY":
+		parsed, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		signer, ok := parsed.(crypto.Signer)
+		if !ok {
+			return nil, fmt.Errorf("unsupported private key")
+		}
+		k.private = signer
+		k.public = signer.Public()
+	case "RSA PRIVATE KEY":
+		parsed, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		k.private = parsed
+		k.public = parsed.Public()
+	case "PUBLIC KEY":
+		parsed, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, err
+		}
+		k.public = parsed
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+
+	switch public := k.public.(type) {
+	case *rsa.PublicKey:
+		if public.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA key is shorter than %d bits", minRSAKeyBits)
+		}
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("unsupported key type %T, use RSA or Ed25519", public)
+	}
+	return k, nil
+}
+
+// Sign stamps the issuer and issue time on claims and signs them with the signing key, naming it
+// in the kid header
+func (s *KeySet) Sign(claims jwt.MapClaims) (string, error) {
+	claims["iss"] = s.Issuer
+	claims["iat"] = time.Now().Unix()
+
+	signing := s.keys[s.signingKeyID]
+	token := jwt.NewWithClaims(signing.method, claims)
+	token.Header["kid"] = signing.id
+	return token.SignedString(signing.private)
+}
+
+// verificationKey returns the public key named by the token's kid header, if the token was
+// signed with that key's algorithm
+func (s *KeySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	k, ok := s.keys[kid]
+	if !ok {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	if token.Method.Alg() != k.method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+	return k.public, nil
+}
+
+// methods returns the algorithms of the loaded keys
+func (s *KeySet) methods() []string {
+	methods := []string{}
+	for _, k := range s.keys {
+		methods = append(methods, k.method.Alg())
+	}
+	return methods
+}
+
+// JWKS returns the public verification keys, sorted by kid
+func (s *KeySet) JWKS() JSONWebKeySet {
+	jwks := JSONWebKeySet{Keys: []JSONWebKey{}}
+	for _, k := range s.keys {
+		jwk := JSONWebKey{KeyID: k.id, Use: "sig", Algorithm: k.method.Alg()}
+		switch public := k.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(public.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(public)
+		}
+		jwks.Keys = append(jwks.Keys, jwk)
+	}
+	sort.Slice(jwks.Keys, func(i, j int) bool {
+		return jwks.Keys[i].KeyID < jwks.Keys[j].KeyID
+	})
+	return jwks
+}
@@ -1,4 +1,12 @@
 package models
 
+import "time"
+
+// Blacklist holds the ids (jti) of revoked access tokens. An entry is only needed until the
+// token would have expired anyway, after which it is pruned.
 type Blacklist struct {
+	ID        uint `gorm:"primarykey"`
+	CreatedAt time.Time
+	TokenID   string    `gorm:"uniqueIndex;size:64"`
+	ExpiresAt time.Time `gorm:"index"`
 }
@@ -0,0 +1,150 @@
+package models
+
+import (
+	"fmt"
+	"math/big"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// JournalFX is the journal entry kind of a conversion between two of a user's wallets
+const JournalFX = "fx"
+
+// LedgerFXAccount is the system account holding our position in each currency we convert through
+const LedgerFXAccount = "system:fx"
+
+// basisPoints is the number of basis points in one
+const basisPoints = 10000
+
+// ExchangeRate is the mid-market rate of a currency pair: one unit of BaseCurrency buys Rate
+// units of QuoteCurrency. SpreadBps is the markup, in basis points, taken off the mid rate
+// when a customer converts in either direction.
+type ExchangeRate struct {
+	gorm.Model
+	BaseCurrency  string `json:"base_currency" gorm:"uniqueIndex:idx_exchange_rate_pair;size:3"`
+	QuoteCurrency string `json:"quote_currency" gorm:"uniqueIndex:idx_exchange_rate_pair;size:3"`
+	Rate          string `json:"rate"`
+	SpreadBps     int64  `json:"spread_bps"`
+}
+
+// FXQuote locks the rate of a conversion for a user until ExpiresAt. It can be executed once.
+type FXQuote struct {
+	gorm.Model
+	UserID     uint       `json:"user_id" gorm:"index"`
+	SellAmount Money      `json:"sell_amount" gorm:"embedded;embeddedPrefix:sell_"`
+	BuyAmount  Money      `json:"buy_amount" gorm:"embedded;embeddedPrefix:buy_"`
+	MidRate    string     `json:"mid_rate"`
+	Rate       string     `json:"rate"`
+	SpreadBps  int64      `json:"spread_bps"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+	ExecutedAt *time.Time `json:"executed_at"`
+}
+
+// IsExpired checks if the quote can no longer be executed
+func (q *FXQuote) IsExpired(now time.Time) bool {
+	return !now.Before(q.ExpiresAt)
+}
+
+// ExchangeRateRequest sets the rate of a currency pair
+type ExchangeRateRequest struct {
+	BaseCurrency  string `json:"base_currency" binding:"required,currency"`
+	QuoteCurrency string `json:"quote_currency" binding:"required,currency,nefield=BaseCurrency"`
+	Rate          string `json:"rate" binding:"required,rate"`
+	SpreadBps     *int64 `json:"spread_bps" binding:"omitempty,min=0,max=9999"`
+}
+
+// FXQuoteRequest asks for a quote to sell Amount of FromCurrency for ToCurrency
+type FXQuoteRequest struct {
+	FromCurrency string `json:"from_currency" binding:"required,currency"`
+	ToCurrency   string `json:"to_currency" binding:"required,currency,nefield=FromCurrency"`
+	Amount       string `json:"amount" binding:"required,amount,max_amount"`
+}
+
+// FXConvertRequest executes a quote
+type FXConvertRequest struct {
+	QuoteID uint   `json:"quote_id" binding:"required"`
+	PIN     string `json:"pin"`
+}
+
+// ParseRate strictly parses a positive decimal rate such as "1550.25"
+func ParseRate(rate string) (*big.Rat, error) {
+	parsed, ok := parsePositiveDecimal(rate)
+	if !ok {
+		return nil, fmt.Errorf("invalid rate %q", rate)
+	}
+	return parsed, nil
+}
+
+// parsePositiveDecimal parses digits with an optional fractional part, rejecting signs,
+// exponents, separators and zero
+func parsePositiveDecimal(decimal string) (*big.Rat, bool) {
+	for i, r := range decimal {
+		if (r < '0' || r > '9') && (r != '.' || i == 0 || i == len(decimal)-1) {
+			return nil, false
+		}
+	}
+	parsed, ok := new(big.Rat).SetString(decimal)
+	if !ok || parsed.Sign() <= 0 {
+		return nil, false
+	}
+	return parsed, true
+}
+
+// CustomerRate returns the mid rate and the rate a customer gets converting from one currency of
+// the pair to the other: the mid rate, inverted when converting from the quote currency, less the spread.
+func (r *ExchangeRate) CustomerRate(from, to string) (*big.Rat, *big.Rat, error) {
+	mid, err := ParseRate(r.Rate)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch {
+	case from == r.BaseCurrency && to == r.QuoteCurrency:
+	case from == r.QuoteCurrency && to == r.BaseCurrency:
+		mid.Inv(mid)
+	default:
+		return nil, nil, fmt.Errorf("rate %s/%s cannot convert %s to %s", r.BaseCurrency, r.QuoteCurrency, from, to)
+	}
+
+	customer := new(big.Rat).Mul(mid, big.NewRat(basisPoints-r.SpreadBps, basisPoints))
+	return mid, customer, nil
+}
+
+// Convert returns amount converted to currency at rate, rounded down to a whole minor unit
+func Convert(amount Money, rate *big.Rat, currency string) (Money, error) {
+	fromExponent, ok := CurrencyExponent(amount.Currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", amount.Currency)
+	}
+	toExponent, ok := CurrencyExponent(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+
+	converted := new(big.Rat).Mul(new(big.Rat).SetInt64(amount.Minor), rate)
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(abs(toExponent-fromExponent))), nil))
+	if toExponent >= fromExponent {
+		converted.Mul(converted, scale)
+	} else {
+		converted.Quo(converted, scale)
+	}
+
+	minor := new(big.Int).Quo(converted.Num(), converted.Denom())
+	if !minor.IsInt64() {
+		return Money{}, fmt.Errorf("converted amount is out of range")
+	}
+	return NewMoney(minor.Int64(), currency), nil
+}
+
+// FormatRate formats a rate as a decimal string for display
+func FormatRate(rate *big.Rat) string {
+	return rate.FloatString(8)
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
@@ -0,0 +1,78 @@
+package models
+
+import (
+	"encoding/base64"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Transaction history directions, from the point of view of the account holder
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+)
+
+// Transaction history limits
+const (
+	DefaultHistoryLimit = 20
+	MaxHistoryLimit     = 100
+)
+
+// TransactionFilter selects a page of an account's transactions. Zero values do not filter.
+// MinAmount and MaxAmount are in minor units of Currency.
+type TransactionFilter struct {
+	AccountNo    int
+	From         time.Time
+	To           time.Time
+	Direction    string
+	Currency     string
+	MinAmount    *int64
+	MaxAmount    *int64
+	Counterparty int
+	Status       string
+	// Ascending sorts oldest first, the default is newest first
+	Ascending bool
+	Cursor    *TransactionCursor
+	Limit     int
+}
+
+// TransactionCursor points at the last transaction of a page; the next page starts after it
+type TransactionCursor struct {
+	TransactionDate time.Time
+	ID              uint
+}
+
+// TransactionPage is a page of transaction history. NextCursor is empty on the last page.
+type TransactionPage struct {
+	Transactions []Transaction `json:"transactions"`
+	NextCursor   string        `json:"next_cursor"`
+}
+
+// Encode returns the cursor as an opaque string for clients
+func (c *TransactionCursor) Encode() string {
+	raw := strconv.FormatInt(c.TransactionDate.UnixNano(), 10) + ":" + strconv.FormatUint(uint64(c.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// DecodeTransactionCursor reads a cursor produced by Encode
+func DecodeTransactionCursor(cursor string) (*TransactionCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	nanos, id, ok := strings.Cut(string(raw), ":")
+	if !ok {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	unixNano, err := strconv.ParseInt(nanos, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	parsedID, err := strconv.ParseUint(id, 10, 64)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cursor")
+	}
+	return &TransactionCursor{TransactionDate: time.Unix(0, unixNano), ID: uint(parsedID)}, nil
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"encoding/base64"
+	"testing"
+	"time"
+)
+
+func TestTransactionCursorRoundTrip(t *testing.T) {
+	cursor := &TransactionCursor{TransactionDate: time.Date(2024, 1, 31, 12, 30, 0, 123456789, time.UTC), ID: 42}
+
+	decoded, err := DecodeTransactionCursor(cursor.Encode())
+	if err != nil {
+		t.Fatalf("decode: %v", err)
+	}
+	if !decoded.TransactionDate.Equal(cursor.TransactionDate) || decoded.ID != cursor.ID {
+		t.Errorf("decoded %v/%d, want %v/%d", decoded.TransactionDate, decoded.ID, cursor.TransactionDate, cursor.ID)
+	}
+}
+
+func TestDecodeTransactionCursorRejectsInvalid(t *testing.T) {
+	encode := func(raw string) string { return base64.RawURLEncoding.EncodeToString([]byte(raw)) }
+	for _, cursor := range []string{
+		"not base64!",
+		encode("1706704200000000000"),
+		encode("yesterday:42"),
+		encode("1706704200000000000:-1"),
+		encode("1706704200000000000:"),
+	} {
+		if _, err := DecodeTransactionCursor(cursor); err == nil {
+			t.Errorf("DecodeTransactionCursor(%q) accepted an invalid cursor", cursor)
+		}
+	}
+}
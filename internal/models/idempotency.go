@@ -0,0 +1,21 @@
+package models
+
+import "time"
+
+// IdempotencyKey remembers a money-moving request made with an Idempotency-Key header and
+// the response it produced, so a retry of the same request replays the response instead of
+// moving money again. Keys are scoped to the user that sent them.
+type IdempotencyKey struct {
+	ID          uint      `gorm:"primarykey"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+	UserID      uint      `json:"user_id" gorm:"uniqueIndex:idx_idempotency_user_key"`
+	Key         string    `json:"key" gorm:"column:idempotency_key;uniqueIndex:idx_idempotency_user_key;size:255"`
+	RequestHash string    `json:"request_hash"`
+	Completed   bool      `json:"completed"`
+	// ReservedUntil is when a request still in progress gives up the key to a retry
+	ReservedUntil time.Time `json:"reserved_until"`
+	StatusCode    int       `json:"status_code"`
+	ResponseBody  []byte    `json:"response_body"`
+	ExpiresAt     time.Time `json:"expires_at" gorm:"index"`
+}
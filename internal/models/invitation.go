@@ -0,0 +1,36 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// AdminInvitation lets one person register as an admin with Role. The invitee receives a signed
+// token carrying the invitation's TokenID; the token can be used once, before ExpiresAt.
+type AdminInvitation struct {
+	gorm.Model
+	TokenID   string     `json:"-" gorm:"uniqueIndex;size:64"`
+	Email     string     `json:"email"`
+	Role      string     `json:"role"`
+	InvitedBy uint       `json:"invited_by"`
+	ExpiresAt time.Time  `json:"expires_at"`
+	UsedAt    *time.Time `json:"used_at"`
+}
+
+// AdminInvitationRequest invites someone to become an admin
+type AdminInvitationRequest struct {
+	Email string `json:"email" binding:"required,email,max=254"`
+	Role  string `json:"role" binding:"required,role"`
+}
+
+// AdminRegistrationRequest registers an invited admin
+type AdminRegistrationRequest struct {
+	Token       string `json:"token" binding:"required"`
+	FirstName   string `json:"first_name" binding:"required,max=50"`
+	LastName    string `json:"last_name" binding:"required,max=50"`
+	Password    string `json:"password" binding:"required,password"`
+	DateOfBirth string `json:"date_of_birth" binding:"required,date,adult"`
+	Phone       string `json:"phone" binding:"omitempty,phone"`
+	Address     string `json:"address" binding:"max=200"`
+}
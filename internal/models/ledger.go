@@ -0,0 +1,65 @@
+package models
+
+import "gorm.io/gorm"
+
+// Ledger account kinds. User wallets are liabilities of the system: a credit
+// increases what we owe the user, a debit reduces it.
+const (
+	LedgerKindAsset     = "asset"
+	LedgerKindLiability = "liability"
+	LedgerKindRevenue   = "revenue"
+	LedgerKindEquity    = "equity"
+)
+
+// System ledger account codes
+const (
+	LedgerFundingAccount = "system:funding"
+	LedgerFeesAccount    = "system:fees"
+	LedgerOpeningAccount = "system:opening"
+)
+
+// Journal entry kinds
+const (
+	JournalTransfer       = "transfer"
+	JournalTopUp          = "topup"
+	JournalFee            = "fee"
+	JournalOpeningBalance = "opening_balance"
+)
+
+// LedgerAccount is an account in the double-entry ledger. Every wallet has one, identified
+// by the account number and currency, alongside a few system accounts per currency.
+type LedgerAccount struct {
+	gorm.Model
+	Code      string `json:"code" gorm:"uniqueIndex"`
+	Name      string `json:"name"`
+	Kind      string `json:"kind"`
+	Currency  string `json:"currency" gorm:"size:3"`
+	AccountNo int    `json:"account_no" gorm:"index"`
+}
+
+// JournalEntry groups postings that must balance: total debits equal total credits in each currency.
+type JournalEntry struct {
+	gorm.Model
+	Kind        string    `json:"kind"`
+	Description string    `json:"description"`
+	Postings    []Posting `json:"postings"`
+}
+
+// Posting is a single debit or credit line against a ledger account, in minor units of Currency.
+type Posting struct {
+	gorm.Model
+	JournalEntryID  uint   `json:"journal_entry_id" gorm:"index"`
+	LedgerAccountID uint   `json:"ledger_account_id" gorm:"index"`
+	Debit           int64  `json:"debit"`
+	Credit          int64  `json:"credit"`
+	Currency        string `json:"currency" gorm:"size:3"`
+}
+
+// Reconciliation compares the stored balance of a wallet with the balance derived from the ledger
+type Reconciliation struct {
+	AccountNo     int   `json:"account_no"`
+	StoredBalance Money `json:"stored_balance"`
+	LedgerBalance Money `json:"ledger_balance"`
+	Difference    Money `json:"difference"`
+	Balanced      bool  `json:"balanced"`
+}
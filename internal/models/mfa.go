@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// RecoveryCodeCount is how many recovery codes are issued when two-factor authentication is enabled
+const RecoveryCodeCount = 10
+
+// TOTP is the two-factor authentication state of a user or admin. The secret is set on
+// enrolment and only enforced once a first code has confirmed it.
+type TOTP struct {
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totp_enabled"`
+	// TOTPLastStep is the time step of the last accepted code, which cannot be used again
+	TOTPLastStep int64 `json:"-"`
+}
+
+// RecoveryCode is a hashed single-use code that stands in for a TOTP code when the
+// authenticator is lost. Audience tells whether SubjectID is a user or an admin.
+type RecoveryCode struct {
+	gorm.Model
+	Audience  string `gorm:"index:idx_recovery_codes_subject"`
+	SubjectID uint   `gorm:"index:idx_recovery_codes_subject"`
+	CodeHash  string `gorm:"size:64"`
+	UsedAt    *time.Time
+}
+
+// TOTPEnrolment is returned when a user or admin starts enrolling an authenticator
+type TOTPEnrolment struct {
+	Secret string `json:"secret"`
+	URI    string `json:"otpauth_uri"`
+}
+
+// MFACodeRequest carries a TOTP code or a recovery code
+type MFACodeRequest struct {
+	Code string `json:"code" binding:"required"`
+}
+
+// MFAEnrolRequest starts an authenticator enrolment with the MFA-pending token issued after the password check
+type MFAEnrolRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+}
+
+// MFALoginRequest completes a login with the MFA-pending token issued after the password check
+type MFALoginRequest struct {
+	MFAToken string `json:"mfa_token" binding:"required"`
+	Code     string `json:"code" binding:"required"`
+}
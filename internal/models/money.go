@@ -0,0 +1,170 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+// DefaultCurrency is the currency accounts are opened in and the currency legacy float amounts were held in
+const DefaultCurrency = "NGN"
+
+// MaxAmount is the largest amount, in major units of its currency, a single request can move
+const MaxAmount = 1000000000
+
+// currencyExponents holds the number of minor unit digits of every supported ISO 4217 currency
+var currencyExponents = map[string]int{
+	"NGN": 2,
+	"USD": 2,
+	"GBP": 2,
+	"EUR": 2,
+	"GHS": 2,
+	"KES": 2,
+	"ZAR": 2,
+	"JPY": 0,
+}
+
+// Money is an amount in the minor units of its currency, e.g. kobo for NGN or cents for USD.
+// It is stored as two columns (minor, currency) and serialized as a decimal string.
+type Money struct {
+	Minor    int64  `json:"-"`
+	Currency string `json:"-" gorm:"size:3"`
+}
+
+// NewMoney returns an amount of minor units in currency
+func NewMoney(minor int64, currency string) Money {
+	return Money{Minor: minor, Currency: currency}
+}
+
+// CurrencyExponent returns the number of minor unit digits of a currency and whether it is supported
+func CurrencyExponent(currency string) (int, bool) {
+	exponent, ok := currencyExponents[currency]
+	return exponent, ok
+}
+
+// IsSupportedCurrency checks if a currency code is one we hold money in
+func IsSupportedCurrency(currency string) bool {
+	_, ok := currencyExponents[currency]
+	return ok
+}
+
+// ParseMoney strictly parses a non-negative decimal string such as "1250.50" in currency.
+// Signs, exponents, separators and more fractional digits than the currency has are rejected.
+func ParseMoney(amount, currency string) (Money, error) {
+	exponent, ok := CurrencyExponent(currency)
+	if !ok {
+		return Money{}, fmt.Errorf("unsupported currency %q", currency)
+	}
+
+	whole, fraction, hasPoint := strings.Cut(amount, ".")
+	if whole == "" || !isDigits(whole) || (hasPoint && (fraction == "" || !isDigits(fraction))) {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	if len(fraction) > exponent {
+		return Money{}, fmt.Errorf("amount %q has more than %d decimal places for %s", amount, exponent, currency)
+	}
+
+	minor, err := strconv.ParseInt(whole+fraction+strings.Repeat("0", exponent-len(fraction)), 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("amount %q is out of range", amount)
+	}
+	return NewMoney(minor, currency), nil
+}
+
+// IsValidAmount checks if amount is a positive decimal string such as "1250.50". The currency
+// decides how many decimal places are allowed, which ParseMoney checks.
+func IsValidAmount(amount string) bool {
+	_, ok := parsePositiveDecimal(amount)
+	return ok
+}
+
+// IsWithinMaxAmount checks if a decimal amount is no more than MaxAmount
+func IsWithinMaxAmount(amount string) bool {
+	parsed, ok := parsePositiveDecimal(amount)
+	return ok && parsed.Cmp(new(big.Rat).SetInt64(MaxAmount)) <= 0
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// Decimal formats the amount as a decimal string in major units, e.g. "1250.50"
+func (m Money) Decimal() string {
+	exponent, _ := CurrencyExponent(m.Currency)
+	minor := m.Minor
+	sign := ""
+	if minor < 0 {
+		sign = "-"
+		minor = -minor
+	}
+	digits := strconv.FormatInt(minor, 10)
+	if exponent == 0 {
+		return sign + digits
+	}
+	if len(digits) <= exponent {
+		digits = strings.Repeat("0", exponent-len(digits)+1) + digits
+	}
+	return sign + digits[:len(digits)-exponent] + "." + digits[len(digits)-exponent:]
+}
+
+func (m Money) String() string {
+	return m.Currency + " " + m.Decimal()
+}
+
+// IsZero checks if the amount is zero
+func (m Money) IsZero() bool {
+	return m.Minor == 0
+}
+
+// SameCurrency checks if both amounts are in the same currency
+func (m Money) SameCurrency(other Money) bool {
+	return m.Currency == other.Currency
+}
+
+// Add returns the sum of two amounts in the same currency
+func (m Money) Add(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, fmt.Errorf("cannot add %s to %s", other.Currency, m.Currency)
+	}
+	return NewMoney(m.Minor+other.Minor, m.Currency), nil
+}
+
+// Sub returns the difference of two amounts in the same currency
+func (m Money) Sub(other Money) (Money, error) {
+	if !m.SameCurrency(other) {
+		return Money{}, fmt.Errorf("cannot subtract %s from %s", other.Currency, m.Currency)
+	}
+	return NewMoney(m.Minor-other.Minor, m.Currency), nil
+}
+
+// moneyJSON is the wire format of Money
+type moneyJSON struct {
+	Amount   string `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+// MarshalJSON writes the amount as {"amount": "1250.50", "currency": "NGN"}
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(moneyJSON{Amount: m.Decimal(), Currency: m.Currency})
+}
+
+// UnmarshalJSON strictly reads an amount written by MarshalJSON
+func (m *Money) UnmarshalJSON(data []byte) error {
+	var wire moneyJSON
+	if err := json.Unmarshal(data, &wire); err != nil {
+		return err
+	}
+	money, err := ParseMoney(wire.Amount, wire.Currency)
+	if err != nil {
+		return err
+	}
+	*m = money
+	return nil
+}
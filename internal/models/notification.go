@@ -0,0 +1,8 @@
+package models
+
+// Notification is a message to a user or admin, such as a password reset link
+type Notification struct {
+	To      string `json:"to"`
+	Subject string `json:"subject"`
+	Body    string `json:"body"`
+}
@@ -0,0 +1,60 @@
+package models
+
+import (
+	"time"
+	"unicode"
+
+	"gorm.io/gorm"
+)
+
+// Password lengths accepted when a password is set or changed. bcrypt ignores bytes past 72.
+const (
+	MinPasswordLength = 8
+	MaxPasswordLength = 72
+)
+
+// IsStrongPassword checks if a password is MinPasswordLength to MaxPasswordLength bytes long and
+// has an upper case letter, a lower case letter and a digit
+func IsStrongPassword(password string) bool {
+	if len(password) < MinPasswordLength || len(password) > MaxPasswordLength {
+		return false
+	}
+	var upper, lower, digit bool
+	for _, r := range password {
+		switch {
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsDigit(r):
+			digit = true
+		}
+	}
+	return upper && lower && digit
+}
+
+// PasswordReset is a single-use password reset token sent to a user. Only its hash is stored.
+type PasswordReset struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex;size:64"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// ForgotPasswordRequest asks for a password reset token
+type ForgotPasswordRequest struct {
+	Email string `json:"email" binding:"required,email"`
+}
+
+// ResetPasswordRequest sets a new password with a reset token
+type ResetPasswordRequest struct {
+	Token    string `json:"token" binding:"required"`
+	Password string `json:"password" binding:"required,password"`
+}
+
+// ChangePasswordRequest sets a new password knowing the current one
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"current_password" binding:"required"`
+	NewPassword     string `json:"new_password" binding:"required,password"`
+}
@@ -0,0 +1,37 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// PhoneOTPLength is the number of digits of a phone verification code
+const PhoneOTPLength = 6
+
+// PhoneOTP is a one-time code texted to a phone number to verify it. Only its hash is stored, and
+// it stops working after it expires or too many wrong codes are tried.
+type PhoneOTP struct {
+	gorm.Model
+	UserID    uint `gorm:"index"`
+	Phone     string
+	CodeHash  string
+	ExpiresAt time.Time
+	Attempts  int
+	UsedAt    *time.Time
+}
+
+// PhoneOTPRequest asks for a verification code for a phone number, the user's own if empty
+type PhoneOTPRequest struct {
+	Phone string `json:"phone" binding:"omitempty,phone"`
+}
+
+// VerifyPhoneRequest verifies a phone number with the code texted to it
+type VerifyPhoneRequest struct {
+	Code string `json:"code" binding:"required,numeric,len=6"`
+}
+
+// IsPhoneVerified checks if the user has verified their phone number
+func (u *User) IsPhoneVerified() bool {
+	return u.PhoneVerifiedAt != nil
+}
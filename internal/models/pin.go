@@ -0,0 +1,51 @@
+package models
+
+import (
+	"time"
+)
+
+// PIN lengths a transaction PIN may have
+const (
+	MinPINLength = 4
+	MaxPINLength = 6
+)
+
+// PIN is a user's transaction PIN, asked for on every debit on top of the access token. After
+// too many wrong PINs in a row, PIN use is locked until PINLockedUntil.
+type PIN struct {
+	PINHash           string     `json:"-"`
+	PINFailedAttempts int        `json:"-"`
+	PINLockedUntil    *time.Time `json:"-"`
+}
+
+// HasPIN checks if a transaction PIN has been set
+func (p PIN) HasPIN() bool {
+	return p.PINHash != ""
+}
+
+// IsValidPIN checks that a PIN is 4 to 6 digits
+func IsValidPIN(pin string) bool {
+	if len(pin) < MinPINLength || len(pin) > MaxPINLength {
+		return false
+	}
+	for _, r := range pin {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// SetPINRequest sets or resets the transaction PIN. The password, and the two-factor code when
+// two-factor authentication is on, prove it is the account holder.
+type SetPINRequest struct {
+	Password string `json:"password" binding:"required"`
+	Code     string `json:"code"`
+	PIN      string `json:"pin" binding:"required,pin"`
+}
+
+// ChangePINRequest changes the transaction PIN knowing the current one
+type ChangePINRequest struct {
+	CurrentPIN string `json:"current_pin" binding:"required"`
+	NewPIN     string `json:"new_pin" binding:"required,pin"`
+}
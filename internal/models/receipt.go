@@ -0,0 +1,50 @@
+package models
+
+import (
+	"strconv"
+	"time"
+)
+
+// ReceiptParty is the payer or recipient named on a receipt
+type ReceiptParty struct {
+	Name      string `json:"name"`
+	AccountNo int    `json:"account_no"`
+}
+
+// Receipt is the customer-facing record of a transaction
+type Receipt struct {
+	Reference       string       `json:"reference"`
+	TransactionType string       `json:"transaction_type"`
+	Status          string       `json:"status"`
+	Payer           ReceiptParty `json:"payer"`
+	Recipient       ReceiptParty `json:"recipient"`
+	Amount          Money        `json:"amount"`
+	Fee             Money        `json:"fee"`
+	Total           Money        `json:"total"`
+	TransactionDate time.Time    `json:"transaction_date"`
+}
+
+// Lines lays the receipt out as lines of text, title first
+func (r *Receipt) Lines() []string {
+	return []string{
+		"Transaction Receipt",
+		"Reference:        " + r.Reference,
+		"Date:             " + r.TransactionDate.Format("2006-01-02 15:04:05 MST"),
+		"Type:             " + r.TransactionType,
+		"Status:           " + r.Status,
+		"",
+		"Payer:            " + r.Payer.line(),
+		"Recipient:        " + r.Recipient.line(),
+		"",
+		"Amount:           " + r.Amount.String(),
+		"Fee:              " + r.Fee.String(),
+		"Total:            " + r.Total.String(),
+	}
+}
+
+func (p ReceiptParty) line() string {
+	if p.AccountNo == 0 {
+		return p.Name
+	}
+	return p.Name + " (" + strconv.Itoa(p.AccountNo) + ")"
+}
@@ -0,0 +1,280 @@
+package models
+
+import "time"
+
+// The response types below are what the API returns instead of the stored models, so that
+// password hashes, second factor secrets and personal details such as the date of birth and
+// address never leave the server. Every handler converts what it returns with one of the
+// New...Response functions.
+
+// UserResponse is a user as the API returns it
+type UserResponse struct {
+	ID               uint      `json:"id"`
+	FirstName        string    `json:"first_name"`
+	LastName         string    `json:"last_name"`
+	Email            string    `json:"email"`
+	EmailVerified    bool      `json:"email_verified"`
+	Phone            string    `json:"phone"`
+	PhoneVerified    bool      `json:"phone_verified"`
+	AccountNo        int       `json:"account_no"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	PINSet           bool      `json:"pin_set"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// NewUserResponse converts a user for the API
+func NewUserResponse(user *User) UserResponse {
+	return UserResponse{
+		ID:               user.ID,
+		FirstName:        user.FirstName,
+		LastName:         user.LastName,
+		Email:            user.Email,
+		EmailVerified:    user.IsEmailVerified(),
+		Phone:            user.Phone,
+		PhoneVerified:    user.IsPhoneVerified(),
+		AccountNo:        user.AccountNo,
+		TwoFactorEnabled: user.TOTPEnabled,
+		PINSet:           user.HasPIN(),
+		CreatedAt:        user.CreatedAt,
+	}
+}
+
+// AdminResponse is an admin as the API returns it
+type AdminResponse struct {
+	ID               uint      `json:"id"`
+	FirstName        string    `json:"first_name"`
+	LastName         string    `json:"last_name"`
+	Email            string    `json:"email"`
+	Role             string    `json:"role"`
+	TwoFactorEnabled bool      `json:"two_factor_enabled"`
+	CreatedAt        time.Time `json:"created_at"`
+}
+
+// NewAdminResponse converts an admin for the API
+func NewAdminResponse(admin *Admin) AdminResponse {
+	return AdminResponse{
+		ID:               admin.ID,
+		FirstName:        admin.FirstName,
+		LastName:         admin.LastName,
+		Email:            admin.Email,
+		Role:             admin.Role,
+		TwoFactorEnabled: admin.TOTPEnabled,
+		CreatedAt:        admin.CreatedAt,
+	}
+}
+
+// WalletResponse is a wallet as the API returns it
+type WalletResponse struct {
+	AccountNo int    `json:"account_no"`
+	Currency  string `json:"currency"`
+	Balance   Money  `json:"balance"`
+}
+
+// NewWalletResponse converts a wallet for the API
+func NewWalletResponse(wallet *Wallet) WalletResponse {
+	return WalletResponse{
+		AccountNo: wallet.AccountNo,
+		Currency:  wallet.Currency(),
+		Balance:   wallet.Balance,
+	}
+}
+
+// NewWalletResponses converts wallets for the API
+func NewWalletResponses(wallets []Wallet) []WalletResponse {
+	responses := make([]WalletResponse, len(wallets))
+	for i := range wallets {
+		responses[i] = NewWalletResponse(&wallets[i])
+	}
+	return responses
+}
+
+// TransactionResponse is a transaction as the API returns it
+type TransactionResponse struct {
+	ID                     uint       `json:"id"`
+	Reference              string     `json:"reference"`
+	PayerAccountNumber     int        `json:"payer_account_number"`
+	RecipientAccountNumber int        `json:"recipient_account_number"`
+	TransactionType        string     `json:"transaction_type"`
+	TransactionAmount      Money      `json:"transaction_amount"`
+	TransactionFee         Money      `json:"transaction_fee"`
+	TransactionDate        time.Time  `json:"transaction_date"`
+	Status                 string     `json:"status"`
+	FailureReason          string     `json:"failure_reason,omitempty"`
+	CompletedAt            *time.Time `json:"completed_at"`
+	FailedAt               *time.Time `json:"failed_at"`
+	ReversedAt             *time.Time `json:"reversed_at"`
+}
+
+// NewTransactionResponse converts a transaction for the API
+func NewTransactionResponse(transaction *Transaction) TransactionResponse {
+	return TransactionResponse{
+		ID:                     transaction.ID,
+		Reference:              transaction.Reference,
+		PayerAccountNumber:     transaction.PayerAccountNumber,
+		RecipientAccountNumber: transaction.RecipientAccountNumber,
+		TransactionType:        transaction.TransactionType,
+		TransactionAmount:      transaction.TransactionAmount,
+		TransactionFee:         transaction.TransactionFee,
+		TransactionDate:        transaction.TransactionDate,
+		Status:                 transaction.Status,
+		FailureReason:          transaction.FailureReason,
+		CompletedAt:            transaction.CompletedAt,
+		FailedAt:               transaction.FailedAt,
+		ReversedAt:             transaction.ReversedAt,
+	}
+}
+
+// NewTransactionResponses converts transactions for the API
+func NewTransactionResponses(transactions []Transaction) []TransactionResponse {
+	responses := make([]TransactionResponse, len(transactions))
+	for i := range transactions {
+		responses[i] = NewTransactionResponse(&transactions[i])
+	}
+	return responses
+}
+
+// TransactionPageResponse is a page of transaction history as the API returns it
+type TransactionPageResponse struct {
+	Transactions []TransactionResponse `json:"transactions"`
+	NextCursor   string                `json:"next_cursor"`
+}
+
+// NewTransactionPageResponse converts a page of transaction history for the API
+func NewTransactionPageResponse(page *TransactionPage) TransactionPageResponse {
+	return TransactionPageResponse{
+		Transactions: NewTransactionResponses(page.Transactions),
+		NextCursor:   page.NextCursor,
+	}
+}
+
+// AdminInvitationResponse is an admin invitation as the API returns it, without its token id
+type AdminInvitationResponse struct {
+	Email     string    `json:"email"`
+	Role      string    `json:"role"`
+	InvitedBy uint      `json:"invited_by"`
+	ExpiresAt time.Time `json:"expires_at"`
+}
+
+// NewAdminInvitationResponse converts an admin invitation for the API
+func NewAdminInvitationResponse(invitation *AdminInvitation) AdminInvitationResponse {
+	return AdminInvitationResponse{
+		Email:     invitation.Email,
+		Role:      invitation.Role,
+		InvitedBy: invitation.InvitedBy,
+		ExpiresAt: invitation.ExpiresAt,
+	}
+}
+
+// ReconciliationResponse is the reconciliation of a wallet as the API returns it
+type ReconciliationResponse struct {
+	AccountNo     int   `json:"account_no"`
+	StoredBalance Money `json:"stored_balance"`
+	LedgerBalance Money `json:"ledger_balance"`
+	Difference    Money `json:"difference"`
+	Balanced      bool  `json:"balanced"`
+}
+
+// NewReconciliationResponses converts the reconciliations of an account's wallets for the API
+func NewReconciliationResponses(reconciliations []Reconciliation) []ReconciliationResponse {
+	responses := make([]ReconciliationResponse, len(reconciliations))
+	for i, reconciliation := range reconciliations {
+		responses[i] = ReconciliationResponse{
+			AccountNo:     reconciliation.AccountNo,
+			StoredBalance: reconciliation.StoredBalance,
+			LedgerBalance: reconciliation.LedgerBalance,
+			Difference:    reconciliation.Difference,
+			Balanced:      reconciliation.Balanced,
+		}
+	}
+	return responses
+}
+
+// ExchangeRateResponse is the rate of a currency pair as the API returns it
+type ExchangeRateResponse struct {
+	BaseCurrency  string    `json:"base_currency"`
+	QuoteCurrency string    `json:"quote_currency"`
+	Rate          string    `json:"rate"`
+	SpreadBps     int64     `json:"spread_bps"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// NewExchangeRateResponse converts an exchange rate for the API
+func NewExchangeRateResponse(rate *ExchangeRate) ExchangeRateResponse {
+	return ExchangeRateResponse{
+		BaseCurrency:  rate.BaseCurrency,
+		QuoteCurrency: rate.QuoteCurrency,
+		Rate:          rate.Rate,
+		SpreadBps:     rate.SpreadBps,
+		UpdatedAt:     rate.UpdatedAt,
+	}
+}
+
+// NewExchangeRateResponses converts exchange rates for the API
+func NewExchangeRateResponses(rates []ExchangeRate) []ExchangeRateResponse {
+	responses := make([]ExchangeRateResponse, len(rates))
+	for i := range rates {
+		responses[i] = NewExchangeRateResponse(&rates[i])
+	}
+	return responses
+}
+
+// FXQuoteResponse is a conversion quote as the API returns it
+type FXQuoteResponse struct {
+	ID         uint      `json:"id"`
+	SellAmount Money     `json:"sell_amount"`
+	BuyAmount  Money     `json:"buy_amount"`
+	MidRate    string    `json:"mid_rate"`
+	Rate       string    `json:"rate"`
+	SpreadBps  int64     `json:"spread_bps"`
+	ExpiresAt  time.Time `json:"expires_at"`
+}
+
+// NewFXQuoteResponse converts a conversion quote for the API
+func NewFXQuoteResponse(quote *FXQuote) FXQuoteResponse {
+	return FXQuoteResponse{
+		ID:         quote.ID,
+		SellAmount: quote.SellAmount,
+		BuyAmount:  quote.BuyAmount,
+		MidRate:    quote.MidRate,
+		Rate:       quote.Rate,
+		SpreadBps:  quote.SpreadBps,
+		ExpiresAt:  quote.ExpiresAt,
+	}
+}
+
+// ReversalResponse is a reversal as the API returns it
+type ReversalResponse struct {
+	ID                    uint      `json:"id"`
+	TransactionID         uint      `json:"transaction_id"`
+	ReversalTransactionID uint      `json:"reversal_transaction_id"`
+	Amount                Money     `json:"amount"`
+	FeeRefund             Money     `json:"fee_refund"`
+	Reason                string    `json:"reason"`
+	ReversedBy            string    `json:"reversed_by"`
+	NegativeBalance       bool      `json:"negative_balance"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+// NewReversalResponse converts a reversal for the API
+func NewReversalResponse(reversal *Reversal) ReversalResponse {
+	return ReversalResponse{
+		ID:                    reversal.ID,
+		TransactionID:         reversal.TransactionID,
+		ReversalTransactionID: reversal.ReversalTransactionID,
+		Amount:                reversal.Amount,
+		FeeRefund:             reversal.FeeRefund,
+		Reason:                reversal.Reason,
+		ReversedBy:            reversal.ReversedBy,
+		NegativeBalance:       reversal.NegativeBalance,
+		CreatedAt:             reversal.CreatedAt,
+	}
+}
+
+// NewReversalResponses converts reversals for the API
+func NewReversalResponses(reversals []Reversal) []ReversalResponse {
+	responses := make([]ReversalResponse, len(reversals))
+	for i := range reversals {
+		responses[i] = NewReversalResponse(&reversals[i])
+	}
+	return responses
+}
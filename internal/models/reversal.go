@@ -0,0 +1,31 @@
+package models
+
+import "gorm.io/gorm"
+
+// JournalReversal is the journal entry kind of a reversal
+const JournalReversal = "reversal"
+
+// Reversal records an admin undoing all or part of a transaction: the compensating
+// transaction that moved the money back, who did it and why.
+type Reversal struct {
+	gorm.Model
+	TransactionID         uint  `json:"transaction_id" gorm:"index"`
+	ReversalTransactionID uint  `json:"reversal_transaction_id"`
+	Amount                Money `json:"amount" gorm:"embedded;embeddedPrefix:amount_"`
+	// FeeRefund is the part of the transfer fee given back to the payer, in proportion to Amount
+	FeeRefund  Money  `json:"fee_refund" gorm:"embedded;embeddedPrefix:fee_refund_"`
+	Reason     string `json:"reason"`
+	ReversedBy string `json:"reversed_by"`
+	// NegativeBalance is set when the reversal overdrew whoever had received the money
+	NegativeBalance bool `json:"negative_balance"`
+}
+
+// ReversalRequest reverses a transaction. Amount is a decimal string in the transaction's
+// currency and defaults to everything not reversed yet. AllowNegativeBalance false refuses the
+// reversal when whoever received the money has already spent it; it cannot allow it when
+// REVERSAL_ALLOW_NEGATIVE does not.
+type ReversalRequest struct {
+	Amount               string `json:"amount" binding:"omitempty,amount,max_amount"`
+	Reason               string `json:"reason" binding:"required,max=500"`
+	AllowNegativeBalance *bool  `json:"allow_negative_balance"`
+}
@@ -0,0 +1,52 @@
+package models
+
+// Admin roles
+const (
+	RoleSupport    = "support"
+	RoleCompliance = "compliance"
+	RoleFinance    = "finance"
+	RoleSuperAdmin = "superadmin"
+)
+
+// Admin permissions, each granted to some of the roles
+const (
+	PermissionViewUsers        = "users:view"
+	PermissionReconcileLedger  = "ledger:reconcile"
+	PermissionManageRates      = "fx:manage"
+	PermissionReverse          = "transactions:reverse"
+	PermissionViewTransactions = "transactions:view"
+	PermissionManageAdmins     = "admins:manage"
+	PermissionResetMFA         = "users:reset_mfa"
+	PermissionUnlockUsers      = "users:unlock"
+)
+
+// rolePermissions lists the permissions of every role but superadmin, which has them all
+var rolePermissions = map[string][]string{
+	RoleSupport:    {PermissionViewUsers, PermissionViewTransactions, PermissionResetMFA, PermissionUnlockUsers},
+	RoleCompliance: {PermissionViewUsers, PermissionViewTransactions, PermissionReconcileLedger},
+	RoleFinance:    {PermissionViewTransactions, PermissionReconcileLedger, PermissionManageRates, PermissionReverse},
+}
+
+// IsValidRole checks if role is one of the admin roles
+func IsValidRole(role string) bool {
+	_, ok := rolePermissions[role]
+	return ok || role == RoleSuperAdmin
+}
+
+// HasPermission checks if the admin's role grants a permission
+func (a *Admin) HasPermission(permission string) bool {
+	if a.Role == RoleSuperAdmin {
+		return true
+	}
+	for _, granted := range rolePermissions[a.Role] {
+		if granted == permission {
+			return true
+		}
+	}
+	return false
+}
+
+// AdminRoleRequest changes the role of an admin
+type AdminRoleRequest struct {
+	Role string `json:"role" binding:"required,role"`
+}
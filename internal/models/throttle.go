@@ -0,0 +1,78 @@
+package models
+
+import "time"
+
+const (
+	// loginFreeFailures failed logins in a row are allowed without a delay
+	loginFreeFailures = 3
+	// maxLoginDelay caps the delay between failed logins before the lockout kicks in
+	maxLoginDelay = time.Minute
+)
+
+// LoginThrottle counts the recent failed logins of one account or one IP address, keyed by
+// LoginAccountKey or LoginIPKey. While LockedUntil is in the future, logins are refused.
+type LoginThrottle struct {
+	ID            uint   `gorm:"primarykey"`
+	Key           string `gorm:"uniqueIndex;size:320"`
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   *time.Time
+}
+
+// LoginLimit is the number of failed logins a throttle key allows before it is locked out
+type LoginLimit struct {
+	Key         string
+	MaxFailures int
+}
+
+// LoginAccountKey is the throttle key of the user or admin email, whether or not it has an account
+func LoginAccountKey(audience string, email string) string {
+	return audience + ":" + email
+}
+
+// LoginIPKey is the throttle key of a client IP address
+func LoginIPKey(ip string) string {
+	return "ip:" + ip
+}
+
+// IsLocked checks if logins are refused at a given time
+func (t LoginThrottle) IsLocked(at time.Time) bool {
+	return t.LockedUntil != nil && at.Before(*t.LockedUntil)
+}
+
+// LockAfterFailure returns until when logins are refused after the last failure: the lockout once
+// maxFailures is reached, otherwise a delay doubling with every failure past the free ones
+func (t LoginThrottle) LockAfterFailure(maxFailures int, lockout time.Duration) *time.Time {
+	var until time.Time
+	switch {
+	case t.Failures >= maxFailures:
+		until = t.LastFailureAt.Add(lockout)
+	case t.Failures > loginFreeFailures:
+		delay := time.Second << uint(t.Failures-loginFreeFailures-1)
+		if delay > maxLoginDelay || delay <= 0 {
+			delay = maxLoginDelay
+		}
+		until = t.LastFailureAt.Add(delay)
+	default:
+		return nil
+	}
+	return &until
+}
+
+// SendThrottle records when a message was last sent for a key, such as the email or the client
+// IP a password reset was asked for, so another is only sent after an interval
+type SendThrottle struct {
+	ID         uint   `gorm:"primarykey"`
+	Key        string `gorm:"uniqueIndex;size:320"`
+	LastSentAt time.Time
+}
+
+// PasswordResetEmailKey is the send throttle key of password resets asked for an email
+func PasswordResetEmailKey(email string) string {
+	return "password-reset:" + email
+}
+
+// PasswordResetIPKey is the send throttle key of password resets asked for from a client IP
+func PasswordResetIPKey(ip string) string {
+	return "password-reset-ip:" + ip
+}
@@ -0,0 +1,34 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLockAfterFailure(t *testing.T) {
+	last := time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+	tests := []struct {
+		failures int
+		want     time.Duration // 0 when not locked
+	}{
+		{1, 0},
+		{3, 0},
+		{4, time.Second},
+		{5, 2 * time.Second},
+		{9, 32 * time.Second},
+		{10, time.Minute},
+		{19, time.Minute},
+		{20, time.Hour},
+		{25, time.Hour},
+	}
+	for _, tt := range tests {
+		throttle := LoginThrottle{Failures: tt.failures, LastFailureAt: last}
+		got := throttle.LockAfterFailure(20, time.Hour)
+		switch {
+		case tt.want == 0 && got != nil:
+			t.Errorf("%d failures: locked until %v, want no lock", tt.failures, got)
+		case tt.want != 0 && (got == nil || !got.Equal(last.Add(tt.want))):
+			t.Errorf("%d failures: locked until %v, want %v", tt.failures, got, last.Add(tt.want))
+		}
+	}
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Audiences of tokens, which also tell whether a subject id is a user or an admin
+const (
+	AudienceUser  = "user"
+	AudienceAdmin = "admin"
+)
+
+// RefreshToken is an issued refresh token. Every refresh rotates it: the token is revoked and
+// replaced by a new one in the same family. Presenting a token that has already been rotated
+// means it was stolen or replayed, so the whole family is revoked. The access token issued
+// along with it is recorded so that it can be blacklisted when the session is revoked.
+type RefreshToken struct {
+	gorm.Model
+	TokenID         string     `json:"-" gorm:"uniqueIndex;size:64"`
+	FamilyID        string     `json:"-" gorm:"index;size:64"`
+	Audience        string     `json:"audience"`
+	SubjectID       uint       `json:"subject_id" gorm:"index"`
+	ExpiresAt       time.Time  `json:"expires_at"`
+	RevokedAt       *time.Time `json:"revoked_at"`
+	ReplacedBy      string     `json:"-"`
+	AccessTokenID   string     `json:"-" gorm:"index;size:64"`
+	AccessExpiresAt time.Time  `json:"-"`
+}
+
+// RefreshRequest exchanges a refresh token for new tokens
+type RefreshRequest struct {
+	RefreshToken string `json:"refresh_token" binding:"required"`
+}
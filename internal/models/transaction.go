@@ -0,0 +1,71 @@
+package models
+
+import (
+	"payment-system-one/internal/util"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// Transaction statuses. A transaction starts pending and ends completed or failed; a completed
+// transaction can later be reversed.
+const (
+	TransactionPending   = "pending"
+	TransactionCompleted = "completed"
+	TransactionFailed    = "failed"
+	TransactionReversed  = "reversed"
+)
+
+// Reason codes recorded when a transaction fails
+const (
+	FailureInsufficientFunds = "insufficient_funds"
+	FailureAccountNotFound   = "account_not_found"
+	FailureCurrencyMismatch  = "currency_mismatch"
+	FailureExpired           = "expired"
+	FailureProviderError     = "provider_error"
+	FailureInternalError     = "internal_error"
+)
+
+// transactionTransitions lists the statuses each status may move to
+var transactionTransitions = map[string][]string{
+	TransactionPending:   {TransactionCompleted, TransactionFailed},
+	TransactionCompleted: {TransactionReversed},
+}
+
+// CanTransition checks if a transaction may move from one status to another
+func CanTransition(from, to string) bool {
+	for _, allowed := range transactionTransitions[from] {
+		if allowed == to {
+			return true
+		}
+	}
+	return false
+}
+
+// SetStatus moves the transaction to status, stamping the time of the transition and, for failures,
+// the reason code. It does not check that the transition is allowed: see CanTransition.
+func (t *Transaction) SetStatus(status, reason string, at time.Time) {
+	t.Status = status
+	switch status {
+	case TransactionCompleted:
+		t.CompletedAt = &at
+	case TransactionFailed:
+		t.FailedAt = &at
+		t.FailureReason = reason
+	case TransactionReversed:
+		t.ReversedAt = &at
+	}
+}
+
+// BeforeCreate gives every transaction a unique reference customers can quote
+func (t *Transaction) BeforeCreate(tx *gorm.DB) error {
+	if t.Reference != "" {
+		return nil
+	}
+	reference, err := util.GenerateReference(time.Now())
+	if err != nil {
+		return err
+	}
+	t.Reference = reference
+	return nil
+}
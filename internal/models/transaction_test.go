@@ -0,0 +1,45 @@
+package models
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCanTransition(t *testing.T) {
+	statuses := []string{TransactionPending, TransactionCompleted, TransactionFailed, TransactionReversed}
+	legal := map[[2]string]bool{
+		{TransactionPending, TransactionCompleted}:  true,
+		{TransactionPending, TransactionFailed}:     true,
+		{TransactionCompleted, TransactionReversed}: true,
+	}
+	for _, from := range statuses {
+		for _, to := range statuses {
+			if got, want := CanTransition(from, to), legal[[2]string{from, to}]; got != want {
+				t.Errorf("CanTransition(%q, %q) = %v, want %v", from, to, got, want)
+			}
+		}
+	}
+}
+
+func TestSetStatus(t *testing.T) {
+	at := time.Date(2024, 1, 31, 12, 0, 0, 0, time.UTC)
+
+	failed := &Transaction{Status: TransactionPending}
+	failed.SetStatus(TransactionFailed, FailureExpired, at)
+	if failed.Status != TransactionFailed || failed.FailureReason != FailureExpired ||
+		failed.FailedAt == nil || !failed.FailedAt.Equal(at) || failed.CompletedAt != nil {
+		t.Errorf("failed transaction = %+v", failed)
+	}
+
+	completed := &Transaction{Status: TransactionPending}
+	completed.SetStatus(TransactionCompleted, "", at)
+	if completed.Status != TransactionCompleted || completed.CompletedAt == nil || completed.FailedAt != nil ||
+		completed.FailureReason != "" {
+		t.Errorf("completed transaction = %+v", completed)
+	}
+
+	completed.SetStatus(TransactionReversed, "", at.Add(time.Hour))
+	if completed.Status != TransactionReversed || completed.ReversedAt == nil || completed.CompletedAt == nil {
+		t.Errorf("reversed transaction = %+v", completed)
+	}
+}
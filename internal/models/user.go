@@ -6,28 +6,53 @@ import (
 	"gorm.io/gorm"
 )
 
+// DateOfBirthLayout is the format of dates of birth, e.g. 1990-05-21
+const DateOfBirthLayout = "2006-01-02"
+
+// MinAge is how old, in years, users and admins must be to register
+const MinAge = 18
+
+// IsValidDateOfBirth checks if a date of birth is a date in DateOfBirthLayout, not in the future
+func IsValidDateOfBirth(dateOfBirth string) bool {
+	born, err := time.Parse(DateOfBirthLayout, dateOfBirth)
+	return err == nil && !born.After(time.Now())
+}
+
+// IsAdult checks if someone born on dateOfBirth is at least MinAge years old
+func IsAdult(dateOfBirth string) bool {
+	born, err := time.Parse(DateOfBirthLayout, dateOfBirth)
+	return err == nil && !born.AddDate(MinAge, 0, 0).After(time.Now())
+}
+
 type User struct {
 	gorm.Model
-	FirstName        string  `json:"first_name"`
-	LastName         string  `json:"last_name"`
-	Password         string  `json:"password"`
-	DateOfBirth      string  `json:"date_of_birth"`
-	Email            string  `json:"email"`
-	AccountNo        int     `json:"account_no"`
-	AvailableBalance float64 `json:"available_balance"`
-	Phone            string  `json:"phone"`
-	Address          string  `json:"address"`
+	FirstName   string `json:"first_name"`
+	LastName    string `json:"last_name"`
+	Password    string `json:"-"`
+	DateOfBirth string `json:"date_of_birth"`
+	Email       string `json:"email"`
+	AccountNo   int    `json:"account_no"`
+	Phone       string `json:"phone"`
+	Address     string `json:"address"`
+	// EmailVerifiedAt is when the user verified their email, money cannot move until they have
+	EmailVerifiedAt *time.Time `json:"email_verified_at"`
+	// PhoneVerifiedAt is when the user verified Phone with a texted code
+	PhoneVerifiedAt *time.Time `json:"phone_verified_at"`
+	TOTP
+	PIN
 }
 
 type Admin struct {
 	gorm.Model
 	FirstName   string `json:"first_name"`
 	LastName    string `json:"last_name"`
-	Password    string `json:"password"`
+	Password    string `json:"-"`
 	DateOfBirth string `json:"date_of_birth"`
 	Email       string `json:"email"`
 	Phone       string `json:"phone"`
 	Address     string `json:"address"`
+	Role        string `json:"role"`
+	TOTP
 }
 
 //type UserProfile struct {
@@ -39,28 +64,78 @@ type Admin struct {
 
 type Transaction struct {
 	gorm.Model
-	PayerAccountNumber     int       `json:"payer_account_number"`
-	RecipientAccountNumber int       `json:"recipient_account_number"`
-	TransactionType        string    `json:"transaction_type"`
-	TransactionAmount      float64   `json:"transaction_amount"`
-	TransactionDate        time.Time `json:"transaction_date"`
+	Reference              string     `json:"reference" gorm:"uniqueIndex;size:32"`
+	PayerAccountNumber     int        `json:"payer_account_number" gorm:"index"`
+	RecipientAccountNumber int        `json:"recipient_account_number" gorm:"index"`
+	TransactionType        string     `json:"transaction_type"`
+	TransactionAmount      Money      `json:"transaction_amount" gorm:"embedded;embeddedPrefix:transaction_amount_"`
+	TransactionFee         Money      `json:"transaction_fee" gorm:"embedded;embeddedPrefix:transaction_fee_"`
+	TransactionDate        time.Time  `json:"transaction_date" gorm:"index"`
+	JournalEntryID         uint       `json:"journal_entry_id"`
+	LinkedTransactionID    uint       `json:"linked_transaction_id"`
+	Status                 string     `json:"status" gorm:"index"`
+	FailureReason          string     `json:"failure_reason,omitempty"`
+	CompletedAt            *time.Time `json:"completed_at"`
+	FailedAt               *time.Time `json:"failed_at"`
+	ReversedAt             *time.Time `json:"reversed_at"`
+}
+
+// RegisterUserRequest registers a user
+type RegisterUserRequest struct {
+	FirstName   string `json:"first_name" binding:"required,max=50"`
+	LastName    string `json:"last_name" binding:"required,max=50"`
+	Email       string `json:"email" binding:"required,email,max=254"`
+	Password    string `json:"password" binding:"required,password"`
+	DateOfBirth string `json:"date_of_birth" binding:"required,date,adult"`
+	Phone       string `json:"phone" binding:"omitempty,phone"`
+	Address     string `json:"address" binding:"max=200"`
 }
 
 type LoginRequest struct {
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	Email    string `json:"email" binding:"required"`
+	Password string `json:"password" binding:"required"`
 }
 
+// TransferRequest carries the amount as a decimal string, e.g. "1250.50", in the given currency
 type TransferRequest struct {
-	AccountNumber int     `json:"account_no"`
-	Amount        float64 `json:"amount"`
+	AccountNumber int    `json:"account_no" binding:"required"`
+	Amount        string `json:"amount" binding:"required,amount,max_amount"`
+	Currency      string `json:"currency" binding:"omitempty,currency"`
+	// PIN is the transaction PIN, required on transfers
+	PIN string `json:"pin"`
+}
+
+// Money parses the requested amount, defaulting to the default currency
+func (r *TransferRequest) Money() (Money, error) {
+	return requestMoney(r.Amount, r.Currency)
+}
+
+// AddFundsRequest carries the amount to add as a decimal string in the given currency
+type AddFundsRequest struct {
+	Amount   string `json:"amount" binding:"required,amount,max_amount"`
+	Currency string `json:"currency" binding:"omitempty,currency"`
+}
+
+// Money parses the requested amount, defaulting to the default currency
+func (r *AddFundsRequest) Money() (Money, error) {
+	return requestMoney(r.Amount, r.Currency)
+}
+
+func requestMoney(amount, currency string) (Money, error) {
+	if currency == "" {
+		currency = DefaultCurrency
+	}
+	return ParseMoney(amount, currency)
 }
 
 type Dashboard struct {
-	FirstName        string        `json:"first_name"`
-	LastName         string        `json:"last_name"`
-	Email            string        `json:"email"`
-	AccountNo        int           `json:"account_no"`
-	AvailableBalance float64       `json:"available_balance"`
-	UserTransactions []Transaction `json:"user_transactions"`
+	FirstName        string                `json:"first_name"`
+	LastName         string                `json:"last_name"`
+	Email            string                `json:"email"`
+	EmailVerified    bool                  `json:"email_verified"`
+	Phone            string                `json:"phone"`
+	PhoneVerified    bool                  `json:"phone_verified"`
+	AccountNo        int                   `json:"account_no"`
+	Wallets          []WalletResponse      `json:"wallets"`
+	UserTransactions []TransactionResponse `json:"user_transactions"`
 }
@@ -0,0 +1,26 @@
+package models
+
+import (
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// EmailVerification is a single-use token sent to a user to verify their email. Only its hash is stored.
+type EmailVerification struct {
+	gorm.Model
+	UserID    uint   `gorm:"index"`
+	TokenHash string `gorm:"uniqueIndex;size:64"`
+	ExpiresAt time.Time
+	UsedAt    *time.Time
+}
+
+// VerifyEmailRequest verifies an email with the token sent to it
+type VerifyEmailRequest struct {
+	Token string `json:"token" binding:"required"`
+}
+
+// IsEmailVerified checks if the user has verified their email
+func (u *User) IsEmailVerified() bool {
+	return u.EmailVerifiedAt != nil
+}
@@ -0,0 +1,22 @@
+package models
+
+import "gorm.io/gorm"
+
+// Wallet holds a user's balance in one currency. A user has at most one wallet per currency,
+// and every wallet has its own ledger account.
+type Wallet struct {
+	gorm.Model
+	UserID    uint  `json:"user_id" gorm:"index"`
+	AccountNo int   `json:"account_no" gorm:"index"`
+	Balance   Money `json:"balance" gorm:"embedded;embeddedPrefix:balance_"`
+}
+
+// Currency is the currency the wallet holds
+func (w *Wallet) Currency() string {
+	return w.Balance.Currency
+}
+
+// OpenWalletRequest asks for a new wallet in a currency
+type OpenWalletRequest struct {
+	Currency string `json:"currency" binding:"required,currency"`
+}
@@ -0,0 +1,48 @@
+package notifier
+
+import (
+	"encoding/json"
+	"os"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"sync"
+	"time"
+)
+
+// File appends notifications to a file as JSON lines instead of delivering them, for development
+// and tests that need to read what was sent
+type File struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewFile returns a notifier that appends notifications to the file at path
+func NewFile(path string) ports.Notifier {
+	return &File{Path: path}
+}
+
+// fileNotification is a line of the file
+type fileNotification struct {
+	models.Notification
+	SentAt time.Time `json:"sent_at"`
+}
+
+func (f *File) Notify(notification models.Notification) error {
+	line, err := json.Marshal(fileNotification{Notification: notification, SentAt: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	file, err := os.OpenFile(f.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
@@ -0,0 +1,78 @@
+package notifier
+
+import (
+	"encoding/json"
+	"os"
+	"payment-system-one/internal/ports"
+	"sync"
+	"time"
+)
+
+// SMS is a text message kept by the local SMS senders
+type SMS struct {
+	To      string    `json:"to"`
+	Message string    `json:"message"`
+	SentAt  time.Time `json:"sent_at"`
+}
+
+// SMSFile appends text messages to a file as JSON lines instead of sending them, for development
+type SMSFile struct {
+	Path string
+	mu   sync.Mutex
+}
+
+// NewSMSFile returns an SMS sender that appends messages to the file at path
+func NewSMSFile(path string) ports.SMSSender {
+	return &SMSFile{Path: path}
+}
+
+func (s *SMSFile) SendSMS(to string, message string) error {
+	line, err := json.Marshal(SMS{To: to, Message: message, SentAt: time.Now()})
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	file, err := os.OpenFile(s.Path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(append(line, '\n')); err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// SMSInbox keeps text messages in memory instead of sending them, so tests can read them back
+type SMSInbox struct {
+	mu       sync.Mutex
+	messages []SMS
+}
+
+// NewSMSInbox returns an empty in-memory SMS inbox
+func NewSMSInbox() *SMSInbox {
+	return &SMSInbox{}
+}
+
+func (s *SMSInbox) SendSMS(to string, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.messages = append(s.messages, SMS{To: to, Message: message, SentAt: time.Now()})
+	return nil
+}
+
+// Messages returns the messages sent to a number, oldest first
+func (s *SMSInbox) Messages(to string) []SMS {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	messages := []SMS{}
+	for _, message := range s.messages {
+		if message.To == to {
+			messages = append(messages, message)
+		}
+	}
+	return messages
+}
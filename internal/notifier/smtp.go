@@ -0,0 +1,47 @@
+package notifier
+
+import (
+	"fmt"
+	"net"
+	"net/smtp"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"strings"
+	"time"
+)
+
+// SMTP delivers notifications as plain text emails through an SMTP server
+type SMTP struct {
+	Addr string
+	From string
+	Auth smtp.Auth
+}
+
+// NewSMTP returns a notifier that sends emails through the server at host:port from the address
+// from, authenticating with PLAIN auth when a username is given
+func NewSMTP(host string, port string, username string, password string, from string) ports.Notifier {
+	var auth smtp.Auth
+	if username != "" {
+		auth = smtp.PlainAuth("", username, password, host)
+	}
+	return &SMTP{Addr: net.JoinHostPort(host, port), From: from, Auth: auth}
+}
+
+func (s *SMTP) Notify(notification models.Notification) error {
+	// header values come from our own code, but a line break in one would inject headers
+	if strings.ContainsAny(notification.To+notification.Subject, "\r\n") {
+		return fmt.Errorf("invalid notification header")
+	}
+
+	message := strings.Join([]string{
+		"From: " + s.From,
+		"To: " + notification.To,
+		"Subject: " + notification.Subject,
+		"Date: " + time.Now().Format(time.RFC1123Z),
+		"MIME-Version: 1.0",
+		"Content-Type: text/plain; charset=UTF-8",
+		"",
+		strings.ReplaceAll(notification.Body, "\n", "\r\n"),
+	}, "\r\n")
+	return smtp.SendMail(s.Addr, s.Auth, s.From, []string{notification.To}, []byte(message))
+}
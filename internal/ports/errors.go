@@ -0,0 +1,35 @@
+package ports
+
+import "errors"
+
+// Errors returned by Repository implementations that handlers act on
+var (
+	ErrInsufficientFunds        = errors.New("insufficient funds")
+	ErrSameAccount              = errors.New("cannot transfer to the same account")
+	ErrCurrencyMismatch         = errors.New("currency does not match the account")
+	ErrWalletNotFound           = errors.New("no wallet in this currency")
+	ErrQuoteNotFound            = errors.New("quote not found")
+	ErrQuoteExpired             = errors.New("quote has expired")
+	ErrQuoteUsed                = errors.New("quote has already been used")
+	ErrIllegalTransition        = errors.New("transaction cannot move to this status")
+	ErrNotReversible            = errors.New("transaction cannot be reversed")
+	ErrReversalExceedsAmount    = errors.New("reversal exceeds what is left of the transaction")
+	ErrInvitationInvalid        = errors.New("invitation is invalid, used or expired")
+	ErrAdminExists              = errors.New("admin already exists")
+	ErrRefreshTokenInvalid      = errors.New("refresh token is invalid or expired")
+	ErrRefreshTokenReused       = errors.New("refresh token has already been used")
+	ErrTOTPCodeUsed             = errors.New("two-factor code has already been used")
+	ErrRecoveryCodeInvalid      = errors.New("recovery code is invalid or used")
+	ErrAccountNotFound          = errors.New("account not found")
+	ErrUserNotFound             = errors.New("user not found")
+	ErrAdminNotFound            = errors.New("admin not found")
+	ErrTransactionNotFound      = errors.New("transaction not found")
+	ErrExchangeRateNotFound     = errors.New("no exchange rate for this currency pair")
+	ErrResetTokenInvalid        = errors.New("password reset token is invalid, used or expired")
+	ErrVerificationTokenInvalid = errors.New("verification token is invalid, used or expired")
+	ErrPhoneOTPInvalid          = errors.New("phone verification code is invalid, used or expired")
+	ErrPhoneOTPAttemptsExceeded = errors.New("too many wrong codes, ask for a new one")
+	ErrPINLocked                = errors.New("too many wrong PINs, PIN use is locked")
+	ErrLoginLocked              = errors.New("too many failed logins, logins are locked")
+	ErrSendThrottled            = errors.New("sent recently, try again later")
+)
@@ -0,0 +1,8 @@
+package ports
+
+import "payment-system-one/internal/models"
+
+// Notifier delivers notifications to users and admins
+type Notifier interface {
+	Notify(notification models.Notification) error
+}
@@ -1,15 +1,80 @@
 package ports
 
-import "payment-system-one/internal/models"
+import (
+	"payment-system-one/internal/models"
+	"time"
+)
 
 type Repository interface {
+	IdempotencyStore
 	FindUserByEmail(email string) (*models.User, error)
-	TokenInBlacklist(token *string) bool
+	FindUserByID(id uint) (*models.User, error)
+	TokenInBlacklist(tokenID string) (bool, error)
+	BlacklistToken(tokenID string, expiresAt time.Time) error
+	PruneBlacklist() (int64, error)
 	CreateUser(user *models.User) error
 	UpdateUser(user *models.User) error
 	FindAdminByEmail(email string) (*models.Admin, error)
+	FindAdminByID(id uint) (*models.Admin, error)
 	CreateAdmin(admin *models.Admin) error
+	SetAdminRole(id uint, role string) (*models.Admin, error)
+	CreateAdminInvitation(invitation *models.AdminInvitation) error
+	AcceptAdminInvitation(tokenID string, admin *models.Admin) error
+	CreateFirstSuperAdmin(admin *models.Admin) error
+	CreateRefreshToken(token *models.RefreshToken) error
+	RotateRefreshToken(tokenID string, next *models.RefreshToken) (*models.RefreshToken, error)
+	RevokeSession(accessTokenID string, expiresAt time.Time) error
+	RevokeAllSessions(audience string, subjectID uint) error
+	UpdateAdmin(admin *models.Admin) error
+	SetTOTP(audience string, subjectID uint, totp models.TOTP) error
+	AcceptTOTPStep(audience string, subjectID uint, step int64) error
+	ReplaceRecoveryCodes(audience string, subjectID uint, codeHashes []string) error
+	UseRecoveryCode(audience string, subjectID uint, codeHash string) error
+	ResetTOTP(audience string, subjectID uint) error
+	SetPIN(user *models.User, pinHash string) error
+	ReservePINAttempt(user *models.User, maxAttempts int, lockout time.Duration) (*time.Time, error)
+	ResetPINFailures(user *models.User) error
+	ReserveLoginAttempt(limits []models.LoginLimit, lockout time.Duration) (*models.LoginThrottle, error)
+	ReleaseLoginAttempt(limit models.LoginLimit, lockout time.Duration) error
+	ClearLoginFailures(key string) error
+	ReserveSend(key string, interval time.Duration) (time.Time, error)
+	CreatePasswordReset(reset *models.PasswordReset) error
+	ResetPassword(tokenHash string, passwordHash string) (*models.User, error)
+	UpdatePassword(user *models.User, passwordHash string) error
+	CreateEmailVerification(verification *models.EmailVerification) error
+	LastEmailVerification(user *models.User) (time.Time, error)
+	VerifyEmail(tokenHash string) (*models.User, error)
+	CreatePhoneOTP(otp *models.PhoneOTP) error
+	LastPhoneOTP(user *models.User) (*models.PhoneOTP, error)
+	ReservePhoneOTPAttempt(otp *models.PhoneOTP, maxAttempts int) (int, error)
+	VerifyPhone(user *models.User, otp *models.PhoneOTP) error
 	FindUserByAccountNumber(accountNumber int) (*models.User, error)
-	TransferFunds(user *models.User, recipient *models.User, amount float64) error
-	Transaction(account_no int) ([]models.Transaction, error)
+	TransferFunds(user *models.User, recipient *models.User, amount models.Money, fee models.Money) (*models.Transaction, error)
+	AddFunds(user *models.User, amount models.Money) (*models.Transaction, error)
+	Transactions(filter models.TransactionFilter) (*models.TransactionPage, error)
+	FindTransaction(id uint) (*models.Transaction, error)
+	FindTransactionByReference(reference string) (*models.Transaction, error)
+	CreatePendingTransaction(transaction *models.Transaction) error
+	UpdateTransactionStatus(id uint, status, reason string) (*models.Transaction, error)
+	ReverseTransaction(id uint, amount models.Money, reason, reversedBy string, allowNegative bool) (*models.Reversal, error)
+	Reversals(transactionID uint) ([]models.Reversal, error)
+	LedgerBalance(accountNo int, currency string) (models.Money, error)
+	ReconcileBalance(accountNo int) ([]models.Reconciliation, error)
+	OpenWallet(user *models.User, currency string) (*models.Wallet, error)
+	FindWallet(user *models.User, currency string) (*models.Wallet, error)
+	Wallets(user *models.User) ([]models.Wallet, error)
+	SaveExchangeRate(rate *models.ExchangeRate) error
+	SaveExchangeRates(rates []*models.ExchangeRate) error
+	ExchangeRates() ([]models.ExchangeRate, error)
+	FindExchangeRate(from, to string) (*models.ExchangeRate, error)
+	CreateFXQuote(quote *models.FXQuote) error
+	ExecuteFXQuote(user *models.User, quoteID uint) ([]models.Transaction, error)
+}
+
+// IdempotencyStore keeps the Idempotency-Key of money-moving requests and their responses
+type IdempotencyStore interface {
+	ReserveIdempotencyKey(key *models.IdempotencyKey) (*models.IdempotencyKey, bool, error)
+	CompleteIdempotencyKey(key *models.IdempotencyKey) error
+	ReleaseIdempotencyKey(key *models.IdempotencyKey) error
+	PruneIdempotencyKeys() (int64, error)
 }
@@ -0,0 +1,6 @@
+package ports
+
+// SMSSender delivers text messages to phone numbers in E.164 form
+type SMSSender interface {
+	SendSMS(to string, message string) error
+}
@@ -1,12 +1,28 @@
 package repository
 
-import "payment-system-one/internal/models"
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
 
 func (p *Postgres) FindAdminByEmail(email string) (*models.Admin, error) {
 	admin := &models.Admin{}
 
 	if err := p.DB.Where("email = ?", email).First(&admin).Error; err != nil {
-		return nil, err
+		return nil, notFound(err, ports.ErrAdminNotFound)
+	}
+	return admin, nil
+}
+
+func (p *Postgres) FindAdminByID(id uint) (*models.Admin, error) {
+	admin := &models.Admin{}
+
+	if err := p.DB.First(admin, id).Error; err != nil {
+		return nil, notFound(err, ports.ErrAdminNotFound)
 	}
 	return admin, nil
 }
@@ -17,3 +33,77 @@ func (p *Postgres) CreateAdmin(admin *models.Admin) error {
 	}
 	return nil
 }
+
+// SetAdminRole changes the role of an admin
+func (p *Postgres) SetAdminRole(id uint, role string) (*models.Admin, error) {
+	admin := &models.Admin{}
+	if err := p.DB.First(admin, id).Error; err != nil {
+		return nil, notFound(err, ports.ErrAdminNotFound)
+	}
+	if err := p.DB.Model(admin).Update("role", role).Error; err != nil {
+		return nil, err
+	}
+	return admin, nil
+}
+
+// CreateAdminInvitation stores an invitation
+func (p *Postgres) CreateAdminInvitation(invitation *models.AdminInvitation) error {
+	return p.DB.Create(invitation).Error
+}
+
+// AcceptAdminInvitation creates the admin an invitation was issued for and uses the invitation up.
+// The invitation is locked so it cannot be used twice; ports.ErrInvitationInvalid is returned if it
+// does not exist, has been used or has expired.
+func (p *Postgres) AcceptAdminInvitation(tokenID string, admin *models.Admin) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		invitation := &models.AdminInvitation{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_id = ?", tokenID).First(invitation).Error
+		if err == gorm.ErrRecordNotFound {
+			return ports.ErrInvitationInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if invitation.UsedAt != nil || !now.Before(invitation.ExpiresAt) {
+			return ports.ErrInvitationInvalid
+		}
+
+		var existing int64
+		if err := tx.Model(&models.Admin{}).Where("email = ?", invitation.Email).Count(&existing).Error; err != nil {
+			return err
+		}
+		if existing > 0 {
+			return ports.ErrAdminExists
+		}
+
+		admin.Email = invitation.Email
+		admin.Role = invitation.Role
+		if err := tx.Create(admin).Error; err != nil {
+			return err
+		}
+		return tx.Model(invitation).Update("used_at", now).Error
+	})
+}
+
+// CreateFirstSuperAdmin creates a superadmin, as long as there is none yet
+func (p *Postgres) CreateFirstSuperAdmin(admin *models.Admin) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		// serializes concurrent bootstraps
+		if err := tx.Exec("LOCK TABLE admins IN SHARE ROW EXCLUSIVE MODE").Error; err != nil {
+			return err
+		}
+
+		var superAdmins int64
+		if err := tx.Model(&models.Admin{}).Where("role = ?", models.RoleSuperAdmin).Count(&superAdmins).Error; err != nil {
+			return err
+		}
+		if superAdmins > 0 {
+			return ports.ErrAdminExists
+		}
+
+		admin.Role = models.RoleSuperAdmin
+		return tx.Create(admin).Error
+	})
+}
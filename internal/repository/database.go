@@ -26,10 +26,39 @@ func Initialize(dbURI string) (*gorm.DB, error) {
 	if err != nil {
 		//	log.Fatal(err)
 	}
-	err = conn.AutoMigrate(&models.User{}, &models.Admin{}, &models.Transaction{})
+	unverifiableUsers := hasUnverifiableUsers(conn)
+	err = conn.AutoMigrate(&models.User{}, &models.Admin{}, &models.Transaction{},
+		&models.Wallet{}, &models.LedgerAccount{}, &models.JournalEntry{}, &models.Posting{}, &models.IdempotencyKey{},
+		&models.ExchangeRate{}, &models.FXQuote{}, &models.Reversal{},
+		&models.AdminInvitation{}, &models.RefreshToken{}, &models.Blacklist{}, &models.RecoveryCode{},
+		&models.LoginThrottle{}, &models.PasswordReset{}, &models.EmailVerification{},
+		&models.PhoneOTP{}, &models.SendThrottle{})
 	if err != nil {
 		return nil, err
 	}
+	if err = createWalletIndexes(conn); err != nil {
+		return nil, err
+	}
+	if err = migrateLegacyAmounts(conn); err != nil {
+		return nil, err
+	}
+	if err = migrateUserBalances(conn); err != nil {
+		return nil, err
+	}
+	if err = migrateTransactionStatus(conn); err != nil {
+		return nil, err
+	}
+	if err = migrateTransactionReferences(conn); err != nil {
+		return nil, err
+	}
+	if err = migrateAdminRoles(conn); err != nil {
+		return nil, err
+	}
+	if unverifiableUsers {
+		if err = migrateEmailVerification(conn); err != nil {
+			return nil, err
+		}
+	}
 	log.Println("Database connection successful")
 	return conn, nil
 }
@@ -0,0 +1,16 @@
+package repository
+
+import (
+	"errors"
+
+	"gorm.io/gorm"
+)
+
+// notFound translates gorm.ErrRecordNotFound into the domain error of what was looked for, so
+// callers do not depend on gorm. Other errors are returned as they are.
+func notFound(err error, domainErr error) error {
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return domainErr
+	}
+	return err
+}
@@ -0,0 +1,183 @@
+package repository
+
+import (
+	"fmt"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// SaveExchangeRate creates or replaces the rate of a currency pair
+func (p *Postgres) SaveExchangeRate(rate *models.ExchangeRate) error {
+	return saveExchangeRate(p.DB, rate)
+}
+
+// SaveExchangeRates creates or replaces the rates of several currency pairs, all of them or none
+func (p *Postgres) SaveExchangeRates(rates []*models.ExchangeRate) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		for _, rate := range rates {
+			if err := saveExchangeRate(tx, rate); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// saveExchangeRate upserts a rate on its pair within tx
+func saveExchangeRate(tx *gorm.DB, rate *models.ExchangeRate) error {
+	return tx.Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "base_currency"}, {Name: "quote_currency"}},
+		DoUpdates: clause.AssignmentColumns([]string{"rate", "spread_bps", "updated_at"}),
+	}).Create(rate).Error
+}
+
+// ExchangeRates returns the rates of all currency pairs
+func (p *Postgres) ExchangeRates() ([]models.ExchangeRate, error) {
+	rates := []models.ExchangeRate{}
+	if err := p.DB.Order("base_currency, quote_currency").Find(&rates).Error; err != nil {
+		return nil, err
+	}
+	return rates, nil
+}
+
+// FindExchangeRate returns the rate that converts between two currencies, whichever way round the pair is stored
+func (p *Postgres) FindExchangeRate(from, to string) (*models.ExchangeRate, error) {
+	rate := &models.ExchangeRate{}
+	if err := p.DB.Where("(base_currency = ? AND quote_currency = ?) OR (base_currency = ? AND quote_currency = ?)",
+		from, to, to, from).Order("id").First(rate).Error; err != nil {
+		return nil, notFound(err, ports.ErrExchangeRateNotFound)
+	}
+	return rate, nil
+}
+
+// CreateFXQuote stores a quote
+func (p *Postgres) CreateFXQuote(quote *models.FXQuote) error {
+	return p.DB.Create(quote).Error
+}
+
+// ExecuteFXQuote converts between two of the user's wallets at the rate locked by the quote. The
+// quote is locked so it can only be executed once, the target wallet is opened if needed and the
+// sell wallet's balance is checked inside the transaction. Both legs go through the FX position
+// accounts in one journal entry, and are recorded as two linked transactions which are returned.
+func (p *Postgres) ExecuteFXQuote(user *models.User, quoteID uint) ([]models.Transaction, error) {
+	transactions := []models.Transaction{}
+
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		quote := &models.FXQuote{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("id = ? AND user_id = ?", quoteID, user.ID).First(quote).Error
+		if err == gorm.ErrRecordNotFound {
+			return ports.ErrQuoteNotFound
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if quote.ExecutedAt != nil {
+			return ports.ErrQuoteUsed
+		}
+		if quote.IsExpired(now) {
+			return ports.ErrQuoteExpired
+		}
+
+		if _, err := openWallet(tx, user, quote.BuyAmount.Currency); err != nil {
+			return err
+		}
+		sellKey := walletKey{user.ID, quote.SellAmount.Currency}
+		buyKey := walletKey{user.ID, quote.BuyAmount.Currency}
+		locked, err := lockWallets(tx, sellKey, buyKey)
+		if err == gorm.ErrRecordNotFound {
+			return ports.ErrWalletNotFound
+		}
+		if err != nil {
+			return err
+		}
+		sellWallet, buyWallet := locked[sellKey], locked[buyKey]
+
+		if sellWallet.Balance.Minor < quote.SellAmount.Minor {
+			return ports.ErrInsufficientFunds
+		}
+
+		sellAccount, err := userLedgerAccount(tx, sellWallet)
+		if err != nil {
+			return err
+		}
+		buyAccount, err := userLedgerAccount(tx, buyWallet)
+		if err != nil {
+			return err
+		}
+		sellPosition, err := systemLedgerAccount(tx, models.LedgerFXAccount, models.LedgerKindAsset, quote.SellAmount.Currency)
+		if err != nil {
+			return err
+		}
+		buyPosition, err := systemLedgerAccount(tx, models.LedgerFXAccount, models.LedgerKindAsset, quote.BuyAmount.Currency)
+		if err != nil {
+			return err
+		}
+
+		postings := append(transferPostings(sellAccount, sellPosition, quote.SellAmount),
+			transferPostings(buyPosition, buyAccount, quote.BuyAmount)...)
+		entry, err := postJournalEntry(tx, models.JournalFX,
+			fmt.Sprintf("conversion of %s to %s for %d", quote.SellAmount, quote.BuyAmount.Currency, user.AccountNo),
+			postings)
+		if err != nil {
+			return err
+		}
+
+		if err := adjustBalance(tx, sellWallet, -quote.SellAmount.Minor); err != nil {
+			return err
+		}
+		if err := adjustBalance(tx, buyWallet, quote.BuyAmount.Minor); err != nil {
+			return err
+		}
+
+		sell := &models.Transaction{
+			PayerAccountNumber:     user.AccountNo,
+			RecipientAccountNumber: user.AccountNo,
+			TransactionType:        "fx_sell",
+			TransactionAmount:      quote.SellAmount,
+			TransactionFee:         models.NewMoney(0, quote.SellAmount.Currency),
+			TransactionDate:        now,
+			JournalEntryID:         entry.ID,
+		}
+		sell.SetStatus(models.TransactionCompleted, "", now)
+		if err := tx.Create(sell).Error; err != nil {
+			return err
+		}
+		buy := &models.Transaction{
+			PayerAccountNumber:     user.AccountNo,
+			RecipientAccountNumber: user.AccountNo,
+			TransactionType:        "fx_buy",
+			TransactionAmount:      quote.BuyAmount,
+			TransactionFee:         models.NewMoney(0, quote.BuyAmount.Currency),
+			TransactionDate:        now,
+			JournalEntryID:         entry.ID,
+			LinkedTransactionID:    sell.ID,
+		}
+		buy.SetStatus(models.TransactionCompleted, "", now)
+		if err := tx.Create(buy).Error; err != nil {
+			return err
+		}
+		sell.LinkedTransactionID = buy.ID
+		if err := tx.Model(sell).Update("linked_transaction_id", buy.ID).Error; err != nil {
+			return err
+		}
+
+		quote.ExecutedAt = &now
+		if err := tx.Model(quote).Update("executed_at", now).Error; err != nil {
+			return err
+		}
+
+		transactions = append(transactions, *sell, *buy)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transactions, nil
+}
@@ -0,0 +1,61 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReserveIdempotencyKey stores the key if the user has not used it yet, if their earlier use has
+// expired, or if the earlier request is still not complete past its ReservedUntil. It returns the stored record and whether it was created by this call; when it was not,
+// the record is the earlier request, possibly still in progress.
+func (p *Postgres) ReserveIdempotencyKey(key *models.IdempotencyKey) (*models.IdempotencyKey, bool, error) {
+	existing := &models.IdempotencyKey{}
+	created := false
+
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := tx.Where("user_id = ? AND idempotency_key = ? AND (expires_at <= ? OR (NOT completed AND reserved_until <= ?))",
+			key.UserID, key.Key, now, now).
+			Delete(&models.IdempotencyKey{}).Error; err != nil {
+			return err
+		}
+
+		result := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(key)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 1 {
+			created = true
+			existing = key
+			return nil
+		}
+		return tx.Where("user_id = ? AND idempotency_key = ?", key.UserID, key.Key).First(existing).Error
+	})
+	if err != nil {
+		return nil, false, err
+	}
+	return existing, created, nil
+}
+
+// CompleteIdempotencyKey stores the response of the request made with the key
+func (p *Postgres) CompleteIdempotencyKey(key *models.IdempotencyKey) error {
+	return p.DB.Model(key).Updates(map[string]interface{}{
+		"completed":     true,
+		"status_code":   key.StatusCode,
+		"response_body": key.ResponseBody,
+	}).Error
+}
+
+// ReleaseIdempotencyKey deletes a key whose request failed, so it can be retried
+func (p *Postgres) ReleaseIdempotencyKey(key *models.IdempotencyKey) error {
+	return p.DB.Delete(key).Error
+}
+
+// PruneIdempotencyKeys deletes all expired keys
+func (p *Postgres) PruneIdempotencyKeys() (int64, error) {
+	result := p.DB.Where("expires_at <= ?", time.Now()).Delete(&models.IdempotencyKey{})
+	return result.RowsAffected, result.Error
+}
@@ -0,0 +1,46 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"testing"
+	"time"
+)
+
+func TestReserveIdempotencyKeyTakesOverStaleReservation(t *testing.T) {
+	p := testRepository(t)
+	user := createTestUser(t, p, models.NewMoney(0, models.DefaultCurrency))
+
+	now := time.Now()
+	reserve := func(key string, reservedUntil time.Time) (*models.IdempotencyKey, bool) {
+		t.Helper()
+		stored, created, err := p.ReserveIdempotencyKey(&models.IdempotencyKey{
+			UserID:        user.ID,
+			Key:           key,
+			RequestHash:   "hash",
+			ReservedUntil: reservedUntil,
+			ExpiresAt:     now.Add(time.Hour),
+		})
+		if err != nil {
+			t.Fatalf("reserve %s: %v", key, err)
+		}
+		return stored, created
+	}
+
+	reserve("running", now.Add(time.Minute))
+	if _, created := reserve("running", now.Add(time.Minute)); created {
+		t.Error("a request in progress lost its key")
+	}
+
+	reserve("stale", now.Add(-time.Second))
+	if _, created := reserve("stale", now.Add(time.Minute)); !created {
+		t.Error("a stale reservation was not taken over")
+	}
+
+	done, _ := reserve("done", now.Add(-time.Second))
+	if err := p.CompleteIdempotencyKey(done); err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if stored, created := reserve("done", now.Add(time.Minute)); created || !stored.Completed {
+		t.Error("a completed key was taken over instead of replayed")
+	}
+}
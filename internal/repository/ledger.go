@@ -0,0 +1,198 @@
+package repository
+
+import (
+	"fmt"
+	"payment-system-one/internal/models"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// userLedgerCode returns the ledger account code of a user's wallet in a currency
+func userLedgerCode(accountNo int, currency string) string {
+	return fmt.Sprintf("user:%d:%s", accountNo, currency)
+}
+
+// systemLedgerCode returns the code of a system ledger account in a currency
+func systemLedgerCode(code, currency string) string {
+	return code + ":" + currency
+}
+
+// systemLedgerAccount finds or creates one of the system ledger accounts in a currency
+func systemLedgerAccount(tx *gorm.DB, code, kind, currency string) (*models.LedgerAccount, error) {
+	// concurrent first uses may race to create the account, so conflicts are ignored
+	account := &models.LedgerAccount{
+		Code:     systemLedgerCode(code, currency),
+		Name:     code,
+		Kind:     kind,
+		Currency: currency,
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(account).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("code = ?", account.Code).First(account).Error; err != nil {
+		return nil, err
+	}
+	return account, nil
+}
+
+// userLedgerAccount finds the ledger account of a user's wallet, creating it on first use.
+// Callers hold the lock on the wallet's row, which serializes the creation.
+// A wallet that already holds a balance when its ledger account is created gets an
+// opening balance entry so the ledger agrees with the stored balance from the start.
+func userLedgerAccount(tx *gorm.DB, wallet *models.Wallet) (*models.LedgerAccount, error) {
+	account := &models.LedgerAccount{}
+	err := tx.Where("code = ?", userLedgerCode(wallet.AccountNo, wallet.Currency())).First(account).Error
+	if err == nil {
+		return account, nil
+	}
+	if err != gorm.ErrRecordNotFound {
+		return nil, err
+	}
+
+	// the stored balance is read from the row, not the struct, which callers may have changed
+	stored := &models.Wallet{}
+	if err := tx.Select("balance_minor", "balance_currency").First(stored, wallet.ID).Error; err != nil {
+		return nil, err
+	}
+
+	account = &models.LedgerAccount{
+		Code:      userLedgerCode(wallet.AccountNo, wallet.Currency()),
+		Name:      fmt.Sprintf("%d %s wallet", wallet.AccountNo, wallet.Currency()),
+		Kind:      models.LedgerKindLiability,
+		Currency:  wallet.Currency(),
+		AccountNo: wallet.AccountNo,
+	}
+	if err := tx.Create(account).Error; err != nil {
+		return nil, err
+	}
+
+	if !stored.Balance.IsZero() {
+		opening, err := systemLedgerAccount(tx, models.LedgerOpeningAccount, models.LedgerKindEquity, account.Currency)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := postJournalEntry(tx, models.JournalOpeningBalance, "opening balance",
+			transferPostings(opening, account, stored.Balance)); err != nil {
+			return nil, err
+		}
+	}
+	return account, nil
+}
+
+// transferPostings returns the postings moving amount out of the from account into the to account
+func transferPostings(from, to *models.LedgerAccount, amount models.Money) []models.Posting {
+	if amount.Minor < 0 {
+		from, to, amount.Minor = to, from, -amount.Minor
+	}
+	return []models.Posting{
+		{LedgerAccountID: from.ID, Debit: amount.Minor, Currency: amount.Currency},
+		{LedgerAccountID: to.ID, Credit: amount.Minor, Currency: amount.Currency},
+	}
+}
+
+// postJournalEntry writes a journal entry with its postings after checking that it balances
+// in every currency and that each posting is in the currency of its account
+func postJournalEntry(tx *gorm.DB, kind, description string, postings []models.Posting) (*models.JournalEntry, error) {
+	if len(postings) < 2 {
+		return nil, fmt.Errorf("journal entry needs at least two postings")
+	}
+
+	net := map[string]int64{}
+	for _, posting := range postings {
+		if posting.Debit < 0 || posting.Credit < 0 {
+			return nil, fmt.Errorf("posting amounts cannot be negative")
+		}
+		account := &models.LedgerAccount{}
+		if err := tx.Select("currency").First(account, posting.LedgerAccountID).Error; err != nil {
+			return nil, err
+		}
+		if account.Currency != posting.Currency {
+			return nil, fmt.Errorf("posting in %s against a %s account", posting.Currency, account.Currency)
+		}
+		net[posting.Currency] += posting.Debit - posting.Credit
+	}
+	for currency, difference := range net {
+		if difference != 0 {
+			return nil, fmt.Errorf("journal entry does not balance in %s: off by %d", currency, difference)
+		}
+	}
+
+	entry := &models.JournalEntry{
+		Kind:        kind,
+		Description: description,
+		Postings:    postings,
+	}
+	if err := tx.Create(entry).Error; err != nil {
+		return nil, err
+	}
+	return entry, nil
+}
+
+// ledgerBalance sums the postings of the ledger account of a user's wallet
+func ledgerBalance(tx *gorm.DB, accountNo int, currency string) (models.Money, error) {
+	account := &models.LedgerAccount{}
+	if err := tx.Where("code = ?", userLedgerCode(accountNo, currency)).First(account).Error; err != nil {
+		return models.Money{}, err
+	}
+
+	var balance int64
+	err := tx.Model(&models.Posting{}).
+		Select("COALESCE(SUM(credit - debit), 0)").
+		Where("ledger_account_id = ?", account.ID).
+		Scan(&balance).Error
+	if err != nil {
+		return models.Money{}, err
+	}
+	return models.NewMoney(balance, account.Currency), nil
+}
+
+// LedgerBalance derives the balance of a user's wallet from its ledger postings
+func (p *Postgres) LedgerBalance(accountNo int, currency string) (models.Money, error) {
+	return ledgerBalance(p.DB, accountNo, currency)
+}
+
+// ReconcileBalance compares the stored balance of each of a user's wallets with the one derived
+// from the ledger. The wallets are locked so no transfer can land between the two reads.
+func (p *Postgres) ReconcileBalance(accountNo int) ([]models.Reconciliation, error) {
+	user, err := p.FindUserByAccountNumber(accountNo)
+	if err != nil {
+		return nil, err
+	}
+
+	reconciliations := []models.Reconciliation{}
+	err = p.DB.Transaction(func(tx *gorm.DB) error {
+		wallets := []*models.Wallet{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+			Where("user_id = ?", user.ID).Order("id").Find(&wallets).Error; err != nil {
+			return err
+		}
+
+		for _, wallet := range wallets {
+			if _, err := userLedgerAccount(tx, wallet); err != nil {
+				return err
+			}
+			balance, err := ledgerBalance(tx, accountNo, wallet.Currency())
+			if err != nil {
+				return err
+			}
+			difference, err := wallet.Balance.Sub(balance)
+			if err != nil {
+				return err
+			}
+
+			reconciliations = append(reconciliations, models.Reconciliation{
+				AccountNo:     accountNo,
+				StoredBalance: wallet.Balance,
+				LedgerBalance: balance,
+				Difference:    difference,
+				Balanced:      difference.IsZero(),
+			})
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reconciliations, nil
+}
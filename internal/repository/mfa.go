@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+func (p *Postgres) UpdateAdmin(admin *models.Admin) error {
+	return p.DB.Save(admin).Error
+}
+
+// totpSubject returns the model whose table holds the TOTP state of audience
+func totpSubject(audience string) interface{} {
+	if audience == models.AudienceAdmin {
+		return &models.Admin{}
+	}
+	return &models.User{}
+}
+
+// SetTOTP replaces the TOTP secret and state of a user or admin
+func (p *Postgres) SetTOTP(audience string, subjectID uint, totp models.TOTP) error {
+	return p.DB.Model(totpSubject(audience)).Where("id = ?", subjectID).
+		Updates(map[string]interface{}{
+			"totp_secret":    totp.TOTPSecret,
+			"totp_enabled":   totp.TOTPEnabled,
+			"totp_last_step": totp.TOTPLastStep,
+		}).Error
+}
+
+// AcceptTOTPStep records that the code of step was used. The update only applies while no
+// later code has been used, so concurrent requests cannot both use the same code;
+// ports.ErrTOTPCodeUsed is returned to the loser.
+func (p *Postgres) AcceptTOTPStep(audience string, subjectID uint, step int64) error {
+	result := p.DB.Model(totpSubject(audience)).Where("id = ? AND totp_last_step < ?", subjectID, step).
+		UpdateColumn("totp_last_step", step)
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ports.ErrTOTPCodeUsed
+	}
+	return nil
+}
+
+// ReplaceRecoveryCodes deletes the recovery codes of a user or admin and stores new ones
+func (p *Postgres) ReplaceRecoveryCodes(audience string, subjectID uint, codeHashes []string) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := deleteRecoveryCodes(tx, audience, subjectID); err != nil {
+			return err
+		}
+		codes := make([]models.RecoveryCode, len(codeHashes))
+		for i, hash := range codeHashes {
+			codes[i] = models.RecoveryCode{Audience: audience, SubjectID: subjectID, CodeHash: hash}
+		}
+		return tx.Create(&codes).Error
+	})
+}
+
+// UseRecoveryCode uses up the unused recovery code with codeHash, or returns ports.ErrRecoveryCodeInvalid
+func (p *Postgres) UseRecoveryCode(audience string, subjectID uint, codeHash string) error {
+	result := p.DB.Model(&models.RecoveryCode{}).
+		Where("audience = ? AND subject_id = ? AND code_hash = ? AND used_at IS NULL", audience, subjectID, codeHash).
+		Update("used_at", time.Now())
+	if result.Error != nil {
+		return result.Error
+	}
+	if result.RowsAffected == 0 {
+		return ports.ErrRecoveryCodeInvalid
+	}
+	return nil
+}
+
+// ResetTOTP turns two-factor authentication off for a user or admin and deletes their recovery codes.
+// ports.ErrAccountNotFound is returned if there is no such user or admin.
+func (p *Postgres) ResetTOTP(audience string, subjectID uint) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		result := tx.Model(totpSubject(audience)).Where("id = ?", subjectID).
+			Updates(map[string]interface{}{"totp_secret": "", "totp_enabled": false, "totp_last_step": 0})
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ports.ErrAccountNotFound
+		}
+		return deleteRecoveryCodes(tx, audience, subjectID)
+	})
+}
+
+func deleteRecoveryCodes(tx *gorm.DB, audience string, subjectID uint) error {
+	return tx.Unscoped().Where("audience = ? AND subject_id = ?", audience, subjectID).
+		Delete(&models.RecoveryCode{}).Error
+}
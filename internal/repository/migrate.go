@@ -0,0 +1,93 @@
+package repository
+
+import (
+	"log"
+	"math"
+	"payment-system-one/internal/models"
+
+	"gorm.io/gorm"
+)
+
+// legacyScale converts legacy float amounts, which were all held in the default currency, to minor units
+func legacyScale() int64 {
+	exponent, _ := models.CurrencyExponent(models.DefaultCurrency)
+	return int64(math.Pow10(exponent))
+}
+
+// migrateUserBalances moves the float balance users used to hold into a wallet in the default
+// currency and drops the old column
+func migrateUserBalances(conn *gorm.DB) error {
+	if conn.Migrator().HasColumn(&models.User{}, "available_balance") {
+		log.Println("migrating users.available_balance to wallets")
+
+		err := conn.Transaction(func(tx *gorm.DB) error {
+			if err := tx.Exec("INSERT INTO wallets (created_at, updated_at, user_id, account_no, balance_minor, balance_currency) "+
+				"SELECT NOW(), NOW(), id, account_no, ROUND(COALESCE(available_balance, 0) * ?), ? FROM users ON CONFLICT DO NOTHING",
+				legacyScale(), models.DefaultCurrency).Error; err != nil {
+				return err
+			}
+			return tx.Migrator().DropColumn(&models.User{}, "available_balance")
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	// users with no balance at all still get a wallet in the default currency
+	return conn.Exec("INSERT INTO wallets (created_at, updated_at, user_id, account_no, balance_minor, balance_currency) "+
+		"SELECT NOW(), NOW(), id, account_no, 0, ? FROM users WHERE NOT EXISTS "+
+		"(SELECT 1 FROM wallets WHERE wallets.user_id = users.id) ON CONFLICT DO NOTHING", models.DefaultCurrency).Error
+}
+
+// migrateLegacyAmounts moves the float amounts of transactions into the minor unit columns created
+// by AutoMigrate and drops the float column. Those transactions were in the default currency and
+// charged no fee.
+func migrateLegacyAmounts(conn *gorm.DB) error {
+	if !conn.Migrator().HasColumn(&models.Transaction{}, "transaction_amount") {
+		return nil
+	}
+	log.Println("migrating transactions.transaction_amount to minor units")
+
+	return conn.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Exec("UPDATE transactions SET transaction_amount_minor = ROUND(COALESCE(transaction_amount, 0) * ?), "+
+			"transaction_amount_currency = ?, transaction_fee_minor = 0, transaction_fee_currency = ?",
+			legacyScale(), models.DefaultCurrency, models.DefaultCurrency).Error; err != nil {
+			return err
+		}
+		return tx.Migrator().DropColumn(&models.Transaction{}, "transaction_amount")
+	})
+}
+
+// createWalletIndexes makes sure a user holds at most one wallet per currency. The currency is a
+// column of the embedded balance, so the composite index cannot be declared on the model.
+func createWalletIndexes(conn *gorm.DB) error {
+	return conn.Exec("CREATE UNIQUE INDEX IF NOT EXISTS idx_wallets_user_currency ON wallets (user_id, balance_currency) WHERE deleted_at IS NULL").Error
+}
+
+// migrateTransactionStatus marks transactions recorded before statuses existed as completed on their date
+func migrateTransactionStatus(conn *gorm.DB) error {
+	return conn.Exec("UPDATE transactions SET status = ?, completed_at = transaction_date WHERE status IS NULL OR status = ''",
+		models.TransactionCompleted).Error
+}
+
+// migrateTransactionReferences gives transactions recorded before references existed one in the same format
+func migrateTransactionReferences(conn *gorm.DB) error {
+	return conn.Exec("UPDATE transactions SET reference = 'TRX-' || TO_CHAR(transaction_date, 'YYYYMMDD') || '-' || " +
+		"UPPER(SUBSTR(MD5(id::text || RANDOM()::text), 1, 10)) WHERE reference IS NULL OR reference = ''").Error
+}
+
+// migrateAdminRoles gives admins created before roles existed the least privileged role
+func migrateAdminRoles(conn *gorm.DB) error {
+	return conn.Exec("UPDATE admins SET role = ? WHERE role IS NULL OR role = ''", models.RoleSupport).Error
+}
+
+// hasUnverifiableUsers checks, before AutoMigrate, if users were created before email verification
+// existed. Their addresses were never verified, but they must not be locked out of their money.
+func hasUnverifiableUsers(conn *gorm.DB) bool {
+	return conn.Migrator().HasTable(&models.User{}) && !conn.Migrator().HasColumn(&models.User{}, "email_verified_at")
+}
+
+// migrateEmailVerification treats the emails of users created before email verification existed as verified
+func migrateEmailVerification(conn *gorm.DB) error {
+	return conn.Exec("UPDATE users SET email_verified_at = created_at WHERE email_verified_at IS NULL").Error
+}
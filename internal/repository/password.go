@@ -0,0 +1,59 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreatePasswordReset stores a reset token, replacing the user's earlier unused ones
+func (p *Postgres) CreatePasswordReset(reset *models.PasswordReset) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", reset.UserID).Delete(&models.PasswordReset{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(reset).Error
+	})
+}
+
+// ResetPassword uses up the reset token with tokenHash and sets the password of its user. The token
+// is locked so it cannot be used twice; ports.ErrResetTokenInvalid is returned if it does not
+// exist, has been used or has expired.
+func (p *Postgres) ResetPassword(tokenHash string, passwordHash string) (*models.User, error) {
+	user := &models.User{}
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		reset := &models.PasswordReset{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", tokenHash).First(reset).Error
+		if err == gorm.ErrRecordNotFound {
+			return ports.ErrResetTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if reset.UsedAt != nil || !now.Before(reset.ExpiresAt) {
+			return ports.ErrResetTokenInvalid
+		}
+		if err := tx.Model(reset).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(user, reset.UserID).Error; err != nil {
+			return err
+		}
+		return tx.Model(user).Update("password", passwordHash).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
+
+// UpdatePassword sets a user's password
+func (p *Postgres) UpdatePassword(user *models.User, passwordHash string) error {
+	return p.DB.Model(user).Update("password", passwordHash).Error
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"gorm.io/gorm"
+)
+
+// CreatePhoneOTP stores a phone verification code, replacing the user's earlier unused ones
+func (p *Postgres) CreatePhoneOTP(otp *models.PhoneOTP) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", otp.UserID).Delete(&models.PhoneOTP{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(otp).Error
+	})
+}
+
+// LastPhoneOTP returns the last phone verification code sent to a user, used or not, or
+// ports.ErrPhoneOTPInvalid if none was
+func (p *Postgres) LastPhoneOTP(user *models.User) (*models.PhoneOTP, error) {
+	otp := &models.PhoneOTP{}
+	err := p.DB.Unscoped().Where("user_id = ?", user.ID).Order("created_at DESC").First(otp).Error
+	if err == gorm.ErrRecordNotFound {
+		return nil, ports.ErrPhoneOTPInvalid
+	}
+	if err != nil {
+		return nil, err
+	}
+	return otp, nil
+}
+
+// ReservePhoneOTPAttempt counts an attempt at the code before it is compared, so concurrent guesses
+// cannot all pass the limit, and returns the attempts made so far. It returns
+// ports.ErrPhoneOTPAttemptsExceeded without counting once maxAttempts have been made.
+func (p *Postgres) ReservePhoneOTPAttempt(otp *models.PhoneOTP, maxAttempts int) (int, error) {
+	reserved := []models.PhoneOTP{}
+	err := p.DB.Raw(`UPDATE phone_otps SET attempts = attempts + 1
+		WHERE id = ? AND attempts < ?
+		RETURNING attempts`, otp.ID, maxAttempts).Scan(&reserved).Error
+	if err != nil {
+		return 0, err
+	}
+	if len(reserved) == 0 {
+		return 0, ports.ErrPhoneOTPAttemptsExceeded
+	}
+	return reserved[0].Attempts, nil
+}
+
+// VerifyPhone uses up the code and sets its phone number as the user's verified number. The code
+// is only used once even if requests race; ports.ErrPhoneOTPInvalid is returned to the loser.
+func (p *Postgres) VerifyPhone(user *models.User, otp *models.PhoneOTP) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		result := tx.Model(otp).Where("used_at IS NULL").Update("used_at", now)
+		if result.Error != nil {
+			return result.Error
+		}
+		if result.RowsAffected == 0 {
+			return ports.ErrPhoneOTPInvalid
+		}
+		return tx.Model(user).Updates(map[string]interface{}{
+			"phone":             otp.Phone,
+			"phone_verified_at": now,
+		}).Error
+	})
+}
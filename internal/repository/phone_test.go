@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"errors"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReservePhoneOTPAttemptConcurrently(t *testing.T) {
+	p := testRepository(t)
+	user := createTestUser(t, p, models.NewMoney(0, models.DefaultCurrency))
+	otp := &models.PhoneOTP{UserID: user.ID, Phone: "+2348000000000", CodeHash: "code-hash", ExpiresAt: time.Now().Add(time.Hour)}
+	if err := p.CreatePhoneOTP(otp); err != nil {
+		t.Fatalf("create code: %v", err)
+	}
+
+	const maxAttempts = 5
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted := map[int]bool{}
+	refused := 0
+	for i := 0; i < 4*maxAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attempts, err := p.ReservePhoneOTPAttempt(otp, maxAttempts)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ports.ErrPhoneOTPAttemptsExceeded):
+				refused++
+			case err != nil:
+				t.Errorf("reserve: %v", err)
+			case granted[attempts]:
+				t.Errorf("attempt %d granted twice", attempts)
+			default:
+				granted[attempts] = true
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(granted) != maxAttempts || refused != 3*maxAttempts {
+		t.Errorf("%d attempts granted, %d refused; want %d and %d", len(granted), refused, maxAttempts, 3*maxAttempts)
+	}
+}
@@ -0,0 +1,51 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+)
+
+// SetPIN stores a new transaction PIN hash and lifts any PIN lockout
+func (p *Postgres) SetPIN(user *models.User, pinHash string) error {
+	return p.DB.Model(user).Updates(map[string]interface{}{
+		"pin_hash":            pinHash,
+		"pin_failed_attempts": 0,
+		"pin_locked_until":    nil,
+	}).Error
+}
+
+// ReservePINAttempt counts a PIN attempt before the PIN is checked, so concurrent attempts cannot
+// all pass the lockout check and then each get a guess. The attempt that reaches maxAttempts locks
+// PIN use for lockout in the same statement and starts the count again; it still gets its guess
+// and a right PIN lifts the lock with ResetPINFailures. It returns until when PIN use is locked if
+// this is the last attempt, nil otherwise, or ports.ErrPINLocked with the lock if no attempt is left.
+func (p *Postgres) ReservePINAttempt(user *models.User, maxAttempts int, lockout time.Duration) (*time.Time, error) {
+	now := time.Now()
+	reserved := []models.PIN{}
+	err := p.DB.Raw(`UPDATE users SET
+			pin_failed_attempts = CASE WHEN pin_failed_attempts + 1 >= ? THEN 0 ELSE pin_failed_attempts + 1 END,
+			pin_locked_until = CASE WHEN pin_failed_attempts + 1 >= ? THEN ?::timestamptz ELSE NULL END
+		WHERE id = ? AND (pin_locked_until IS NULL OR pin_locked_until <= ?)
+		RETURNING pin_failed_attempts, pin_locked_until`,
+		maxAttempts, maxAttempts, now.Add(lockout), user.ID, now).Scan(&reserved).Error
+	if err != nil {
+		return nil, err
+	}
+	if len(reserved) == 0 {
+		current := &models.User{}
+		if err := p.DB.Select("pin_locked_until").First(current, user.ID).Error; err != nil {
+			return nil, notFound(err, ports.ErrUserNotFound)
+		}
+		return current.PINLockedUntil, ports.ErrPINLocked
+	}
+	return reserved[0].PINLockedUntil, nil
+}
+
+// ResetPINFailures clears the count of wrong PINs, and the lock set by the last attempt, after a right one
+func (p *Postgres) ResetPINFailures(user *models.User) error {
+	return p.DB.Model(user).UpdateColumns(map[string]interface{}{
+		"pin_failed_attempts": 0,
+		"pin_locked_until":    nil,
+	}).Error
+}
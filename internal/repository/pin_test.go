@@ -0,0 +1,57 @@
+package repository
+
+import (
+	"errors"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReservePINAttemptConcurrently(t *testing.T) {
+	p := testRepository(t)
+	user := createTestUser(t, p, models.NewMoney(0, models.DefaultCurrency))
+	if err := p.SetPIN(user, "pin-hash"); err != nil {
+		t.Fatalf("set PIN: %v", err)
+	}
+
+	const maxAttempts = 5
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted, last, refused := 0, 0, 0
+	for i := 0; i < 4*maxAttempts; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			lockedUntil, err := p.ReservePINAttempt(user, maxAttempts, time.Hour)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ports.ErrPINLocked):
+				refused++
+			case err != nil:
+				t.Errorf("reserve: %v", err)
+			default:
+				granted++
+				if lockedUntil != nil {
+					last++
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if granted != maxAttempts || last != 1 || refused != 3*maxAttempts {
+		t.Errorf("%d attempts granted, %d of them the last, %d refused; want %d, 1 and %d",
+			granted, last, refused, maxAttempts, 3*maxAttempts)
+	}
+
+	// a right PIN on the last attempt lifts the lock
+	if err := p.ResetPINFailures(user); err != nil {
+		t.Fatalf("reset: %v", err)
+	}
+	if _, err := p.ReservePINAttempt(user, maxAttempts, time.Hour); err != nil {
+		t.Errorf("reserve after reset: %v", err)
+	}
+}
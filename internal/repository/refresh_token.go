@@ -0,0 +1,123 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateRefreshToken stores an issued refresh token
+func (p *Postgres) CreateRefreshToken(token *models.RefreshToken) error {
+	return p.DB.Create(token).Error
+}
+
+// RotateRefreshToken revokes the refresh token with tokenID and stores next in its place, in the same
+// family and for the same subject. It returns the rotated token. A token that was already rotated or
+// revoked is being reused: its whole family is revoked and ports.ErrRefreshTokenReused is returned.
+// An unknown or expired token gives ports.ErrRefreshTokenInvalid.
+func (p *Postgres) RotateRefreshToken(tokenID string, next *models.RefreshToken) (*models.RefreshToken, error) {
+	current := &models.RefreshToken{}
+	reused := false
+
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_id = ?", tokenID).First(current).Error
+		if err == gorm.ErrRecordNotFound {
+			return ports.ErrRefreshTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if current.RevokedAt != nil {
+			// the revocation has to be committed, so this is not returned as an error
+			reused = true
+			return revokeRefreshTokenFamily(tx, current.FamilyID, now)
+		}
+		if !now.Before(current.ExpiresAt) {
+			return ports.ErrRefreshTokenInvalid
+		}
+
+		if err := tx.Model(current).Updates(map[string]interface{}{
+			"revoked_at":  now,
+			"replaced_by": next.TokenID,
+		}).Error; err != nil {
+			return err
+		}
+
+		next.FamilyID = current.FamilyID
+		next.Audience = current.Audience
+		next.SubjectID = current.SubjectID
+		return tx.Create(next).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	if reused {
+		return nil, ports.ErrRefreshTokenReused
+	}
+	return current, nil
+}
+
+// RevokeSession logs out the session the access token with accessTokenID belongs to: the
+// access token is blacklisted until expiresAt, and its refresh token family is revoked along
+// with every access token issued in it that has not expired yet
+func (p *Postgres) RevokeSession(accessTokenID string, expiresAt time.Time) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := blacklistToken(tx, accessTokenID, expiresAt); err != nil {
+			return err
+		}
+
+		session := &models.RefreshToken{}
+		err := tx.Where("access_token_id = ?", accessTokenID).First(session).Error
+		if err == gorm.ErrRecordNotFound {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		return revokeRefreshTokenFamily(tx, session.FamilyID, time.Now())
+	})
+}
+
+// RevokeAllSessions logs the user or admin subjectID out everywhere, revoking all their refresh
+// tokens and blacklisting every access token issued to them that has not expired yet
+func (p *Postgres) RevokeAllSessions(audience string, subjectID uint) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		if err := blacklistAccessTokens(tx, tx.Where("audience = ? AND subject_id = ?", audience, subjectID), now); err != nil {
+			return err
+		}
+		return tx.Model(&models.RefreshToken{}).Where("audience = ? AND subject_id = ? AND revoked_at IS NULL", audience, subjectID).
+			Update("revoked_at", now).Error
+	})
+}
+
+// revokeRefreshTokenFamily revokes every token of a family that is not revoked yet, and blacklists
+// the access tokens issued in the family that have not expired
+func revokeRefreshTokenFamily(tx *gorm.DB, familyID string, at time.Time) error {
+	if err := blacklistAccessTokens(tx, tx.Where("family_id = ?", familyID), at); err != nil {
+		return err
+	}
+	return tx.Model(&models.RefreshToken{}).Where("family_id = ? AND revoked_at IS NULL", familyID).
+		Update("revoked_at", at).Error
+}
+
+// blacklistAccessTokens blacklists the access tokens issued with the refresh tokens matching
+// condition that are still valid at
+func blacklistAccessTokens(tx *gorm.DB, condition *gorm.DB, at time.Time) error {
+	sessions := []models.RefreshToken{}
+	if err := tx.Where(condition).Where("access_token_id <> '' AND access_expires_at > ?", at).
+		Find(&sessions).Error; err != nil {
+		return err
+	}
+	for _, session := range sessions {
+		if err := blacklistToken(tx, session.AccessTokenID, session.AccessExpiresAt); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,54 @@
+package repository
+
+import (
+	"fmt"
+	"os"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/util"
+	"testing"
+	"time"
+)
+
+// testRepository connects to the database in TEST_DATABASE_URL, migrating it first.
+// Tests that need Postgres are skipped when it is unset, except in CI where they must run.
+func testRepository(t *testing.T) *Postgres {
+	t.Helper()
+	dbURL := os.Getenv("TEST_DATABASE_URL")
+	if dbURL == "" && os.Getenv("CI") != "" {
+		t.Fatal("TEST_DATABASE_URL must be set in CI")
+	}
+	if dbURL == "" {
+		t.Skip("TEST_DATABASE_URL is not set")
+	}
+	db, err := Initialize(dbURL)
+	if err != nil {
+		t.Fatalf("initialize database: %v", err)
+	}
+	return &Postgres{DB: db}
+}
+
+// createTestUser creates a verified user with a unique email and account number, topped up with funds
+func createTestUser(t *testing.T, p *Postgres, funds models.Money) *models.User {
+	t.Helper()
+	accountNo, err := util.GenerateAccountNumber()
+	if err != nil {
+		t.Fatalf("generate account number: %v", err)
+	}
+	now := time.Now()
+	user := &models.User{
+		FirstName:       "Test",
+		LastName:        "User",
+		Email:           fmt.Sprintf("test-%d-%d@example.com", accountNo, now.UnixNano()),
+		AccountNo:       accountNo,
+		EmailVerifiedAt: &now,
+	}
+	if err := p.CreateUser(user); err != nil {
+		t.Fatalf("create user: %v", err)
+	}
+	if funds.Minor > 0 {
+		if _, err := p.AddFunds(user, funds); err != nil {
+			t.Fatalf("add funds: %v", err)
+		}
+	}
+	return user
+}
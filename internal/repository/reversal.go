@@ -0,0 +1,182 @@
+package repository
+
+import (
+	"fmt"
+	"math/big"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// reversibleTypes are the transaction types a reversal can undo
+var reversibleTypes = map[string]bool{
+	"debit":  true,
+	"credit": true,
+}
+
+// ReverseTransaction moves amount of a completed transfer or top-up back where it came from,
+// or all of what has not been reversed yet when amount is zero. The fee of a transfer is
+// refunded from the fees account in proportion, so a full reversal makes the payer whole. The
+// compensating transaction is linked to the original, which is marked reversed once nothing is
+// left to reverse. Unless allowNegative is set, ports.ErrInsufficientFunds is returned when the
+// wallet that received the money no longer holds enough of it.
+func (p *Postgres) ReverseTransaction(id uint, amount models.Money, reason, reversedBy string, allowNegative bool) (*models.Reversal, error) {
+	reversal := &models.Reversal{}
+
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		original := &models.Transaction{}
+		if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(original, id).Error; err != nil {
+			return notFound(err, ports.ErrTransactionNotFound)
+		}
+		if !reversibleTypes[original.TransactionType] {
+			return ports.ErrNotReversible
+		}
+		if original.Status != models.TransactionCompleted {
+			return ports.ErrIllegalTransition
+		}
+
+		var reversed int64
+		if err := tx.Model(&models.Reversal{}).Select("COALESCE(SUM(amount_minor), 0)").
+			Where("transaction_id = ?", original.ID).Scan(&reversed).Error; err != nil {
+			return err
+		}
+		remaining := original.TransactionAmount.Minor - reversed
+
+		if amount.Minor == 0 {
+			amount = models.NewMoney(remaining, original.TransactionAmount.Currency)
+		}
+		if !amount.SameCurrency(original.TransactionAmount) {
+			return ports.ErrCurrencyMismatch
+		}
+		if amount.Minor <= 0 || amount.Minor > remaining {
+			return ports.ErrReversalExceedsAmount
+		}
+		feeRefund := models.NewMoney(feeShare(original, reversed+amount.Minor)-feeShare(original, reversed), amount.Currency)
+
+		// the money goes back from whoever received it
+		holder, err := findUserByAccountNumber(tx, original.RecipientAccountNumber)
+		if err != nil {
+			return err
+		}
+		holderKey := walletKey{holder.ID, amount.Currency}
+		keys := []walletKey{holderKey}
+
+		var payerKey walletKey
+		if original.TransactionType == "debit" {
+			payer, err := findUserByAccountNumber(tx, original.PayerAccountNumber)
+			if err != nil {
+				return err
+			}
+			payerKey = walletKey{payer.ID, amount.Currency}
+			keys = append(keys, payerKey)
+		}
+
+		locked, err := lockWallets(tx, keys...)
+		if err == gorm.ErrRecordNotFound {
+			return ports.ErrWalletNotFound
+		}
+		if err != nil {
+			return err
+		}
+		holderWallet := locked[holderKey]
+		if !allowNegative && holderWallet.Balance.Minor < amount.Minor {
+			return ports.ErrInsufficientFunds
+		}
+
+		holderAccount, err := userLedgerAccount(tx, holderWallet)
+		if err != nil {
+			return err
+		}
+
+		var sourceAccount *models.LedgerAccount
+		if original.TransactionType == "debit" {
+			sourceAccount, err = userLedgerAccount(tx, locked[payerKey])
+		} else {
+			sourceAccount, err = systemLedgerAccount(tx, models.LedgerFundingAccount, models.LedgerKindAsset, amount.Currency)
+		}
+		if err != nil {
+			return err
+		}
+
+		postings := transferPostings(holderAccount, sourceAccount, amount)
+		if feeRefund.Minor > 0 {
+			feesAccount, err := systemLedgerAccount(tx, models.LedgerFeesAccount, models.LedgerKindRevenue, feeRefund.Currency)
+			if err != nil {
+				return err
+			}
+			postings = append(postings, transferPostings(feesAccount, sourceAccount, feeRefund)...)
+		}
+		entry, err := postJournalEntry(tx, models.JournalReversal,
+			fmt.Sprintf("reversal of transaction %d: %s", original.ID, reason), postings)
+		if err != nil {
+			return err
+		}
+
+		if err := adjustBalance(tx, holderWallet, -amount.Minor); err != nil {
+			return err
+		}
+		if original.TransactionType == "debit" {
+			if err := adjustBalance(tx, locked[payerKey], amount.Minor+feeRefund.Minor); err != nil {
+				return err
+			}
+		}
+
+		now := time.Now()
+		compensating := &models.Transaction{
+			PayerAccountNumber:     original.RecipientAccountNumber,
+			RecipientAccountNumber: original.PayerAccountNumber,
+			TransactionType:        "reversal",
+			TransactionAmount:      amount,
+			TransactionFee:         models.NewMoney(0, amount.Currency),
+			TransactionDate:        now,
+			JournalEntryID:         entry.ID,
+			LinkedTransactionID:    original.ID,
+		}
+		compensating.SetStatus(models.TransactionCompleted, "", now)
+		if err := tx.Create(compensating).Error; err != nil {
+			return err
+		}
+
+		reversal.TransactionID = original.ID
+		reversal.ReversalTransactionID = compensating.ID
+		reversal.Amount = amount
+		reversal.FeeRefund = feeRefund
+		reversal.Reason = reason
+		reversal.ReversedBy = reversedBy
+		reversal.NegativeBalance = holderWallet.Balance.Minor < 0
+		if err := tx.Create(reversal).Error; err != nil {
+			return err
+		}
+
+		if amount.Minor == remaining {
+			return transitionTransaction(tx, original, models.TransactionReversed, "")
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return reversal, nil
+}
+
+// feeShare is the part of the fee of a transfer that goes with its first reversed minor units,
+// rounded down, so that the refunds of partial reversals add up to the whole fee
+func feeShare(transaction *models.Transaction, reversed int64) int64 {
+	if transaction.TransactionAmount.Minor == 0 {
+		return 0
+	}
+	share := new(big.Int).Mul(big.NewInt(transaction.TransactionFee.Minor), big.NewInt(reversed))
+	return share.Quo(share, big.NewInt(transaction.TransactionAmount.Minor)).Int64()
+}
+
+// Reversals returns the reversals of a transaction
+func (p *Postgres) Reversals(transactionID uint) ([]models.Reversal, error) {
+	reversals := []models.Reversal{}
+	if err := p.DB.Where("transaction_id = ?", transactionID).Order("id").Find(&reversals).Error; err != nil {
+		return nil, err
+	}
+	return reversals, nil
+}
@@ -0,0 +1,78 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"testing"
+)
+
+func TestFeeShare(t *testing.T) {
+	transaction := &models.Transaction{
+		TransactionAmount: models.NewMoney(1000, models.DefaultCurrency),
+		TransactionFee:    models.NewMoney(35, models.DefaultCurrency),
+	}
+	tests := []struct {
+		reversed int64
+		want     int64
+	}{
+		{0, 0},
+		{28, 0},
+		{29, 1},
+		{500, 17},
+		{999, 34},
+		{1000, 35},
+	}
+	for _, test := range tests {
+		if got := feeShare(transaction, test.reversed); got != test.want {
+			t.Errorf("feeShare(%d) = %d, want %d", test.reversed, got, test.want)
+		}
+	}
+}
+
+func TestReverseTransactionRefundsFee(t *testing.T) {
+	p := testRepository(t)
+
+	funds := models.NewMoney(5000, models.DefaultCurrency)
+	amount := models.NewMoney(1000, models.DefaultCurrency)
+	fee := models.NewMoney(35, models.DefaultCurrency)
+	payer := createTestUser(t, p, funds)
+	payee := createTestUser(t, p, models.NewMoney(0, models.DefaultCurrency))
+
+	transaction, err := p.TransferFunds(payer, payee, amount, fee)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+
+	partial, err := p.ReverseTransaction(transaction.ID, models.NewMoney(333, models.DefaultCurrency), "partial", "admin@example.com", false)
+	if err != nil {
+		t.Fatalf("partial reversal: %v", err)
+	}
+	if partial.FeeRefund.Minor != 11 {
+		t.Errorf("partial reversal refunded %d of the fee, want 11", partial.FeeRefund.Minor)
+	}
+	rest, err := p.ReverseTransaction(transaction.ID, models.Money{}, "rest", "admin@example.com", false)
+	if err != nil {
+		t.Fatalf("full reversal: %v", err)
+	}
+	if total := partial.FeeRefund.Minor + rest.FeeRefund.Minor; total != fee.Minor {
+		t.Errorf("reversals refunded %d of the fee, want %d", total, fee.Minor)
+	}
+
+	payerWallet, err := p.FindWallet(payer, models.DefaultCurrency)
+	if err != nil {
+		t.Fatalf("find payer wallet: %v", err)
+	}
+	if payerWallet.Balance.Minor != funds.Minor {
+		t.Errorf("payer balance is %d after a full reversal, want %d", payerWallet.Balance.Minor, funds.Minor)
+	}
+	for _, user := range []*models.User{payer, payee} {
+		reconciliations, err := p.ReconcileBalance(user.AccountNo)
+		if err != nil {
+			t.Fatalf("reconcile %d: %v", user.AccountNo, err)
+		}
+		for _, reconciliation := range reconciliations {
+			if !reconciliation.Balanced {
+				t.Errorf("wallet %d is off its ledger by %d", user.AccountNo, reconciliation.Difference.Minor)
+			}
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"sort"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// ReserveLoginAttempt counts a login attempt against every key of limits before the password is
+// checked, as if it failed, and locks each key for the delay or lockout that failure would cause.
+// The throttles are locked for the update, so concurrent attempts are counted one after the other
+// and cannot all pass the check. Counts start again when the previous failure is older than
+// lockout. If a key is locked already nothing is counted, and its throttle is returned with
+// ports.ErrLoginLocked.
+func (p *Postgres) ReserveLoginAttempt(limits []models.LoginLimit, lockout time.Duration) (*models.LoginThrottle, error) {
+	// keys are always locked in the same order so that two attempts cannot deadlock
+	limits = append([]models.LoginLimit{}, limits...)
+	sort.Slice(limits, func(i, j int) bool { return limits[i].Key < limits[j].Key })
+
+	var locked *models.LoginThrottle
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		now := time.Now()
+		throttles := make([]*models.LoginThrottle, len(limits))
+		for i, limit := range limits {
+			throttle, err := lockLoginThrottle(tx, limit.Key)
+			if err != nil {
+				return err
+			}
+			if throttle.IsLocked(now) {
+				locked = throttle
+				return ports.ErrLoginLocked
+			}
+			throttles[i] = throttle
+		}
+
+		for i, throttle := range throttles {
+			if throttle.LastFailureAt.Before(now.Add(-lockout)) {
+				throttle.Failures = 0
+			}
+			throttle.Failures++
+			throttle.LastFailureAt = now
+			throttle.LockedUntil = throttle.LockAfterFailure(limits[i].MaxFailures, lockout)
+			if err := tx.Save(throttle).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return locked, err
+	}
+	return nil, nil
+}
+
+// ReleaseLoginAttempt takes back the attempt counted against limit by ReserveLoginAttempt once the
+// password turned out right, along with the delay it set
+func (p *Postgres) ReleaseLoginAttempt(limit models.LoginLimit, lockout time.Duration) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		throttle, err := lockLoginThrottle(tx, limit.Key)
+		if err != nil {
+			return err
+		}
+		if throttle.Failures > 0 {
+			throttle.Failures--
+		}
+		throttle.LockedUntil = throttle.LockAfterFailure(limit.MaxFailures, lockout)
+		return tx.Save(throttle).Error
+	})
+}
+
+// lockLoginThrottle returns the throttle of key, created without failures if there is none,
+// locked for update until tx ends
+func lockLoginThrottle(tx *gorm.DB, key string) (*models.LoginThrottle, error) {
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+		Create(&models.LoginThrottle{Key: key}).Error; err != nil {
+		return nil, err
+	}
+	throttle := &models.LoginThrottle{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where("key = ?", key).First(throttle).Error; err != nil {
+		return nil, err
+	}
+	return throttle, nil
+}
+
+// ClearLoginFailures forgets the failed logins of key, lifting any lockout
+func (p *Postgres) ClearLoginFailures(key string) error {
+	return p.DB.Where("key = ?", key).Delete(&models.LoginThrottle{}).Error
+}
+
+// ReserveSend records a message sent for key unless one was sent less than interval ago, in a
+// single upsert so concurrent requests cannot both send. Otherwise it returns when the next one
+// may be sent, with ports.ErrSendThrottled.
+func (p *Postgres) ReserveSend(key string, interval time.Duration) (time.Time, error) {
+	now := time.Now()
+	reserved := []models.SendThrottle{}
+	err := p.DB.Raw(`INSERT INTO send_throttles (key, last_sent_at) VALUES (?, ?)
+		ON CONFLICT (key) DO UPDATE SET last_sent_at = EXCLUDED.last_sent_at
+		WHERE send_throttles.last_sent_at <= ?
+		RETURNING id, last_sent_at`, key, now, now.Add(-interval)).Scan(&reserved).Error
+	if err != nil {
+		return time.Time{}, err
+	}
+	if len(reserved) > 0 {
+		return now, nil
+	}
+
+	throttle := &models.SendThrottle{}
+	if err := p.DB.Where("key = ?", key).First(throttle).Error; err != nil {
+		return time.Time{}, err
+	}
+	return throttle.LastSentAt.Add(interval), ports.ErrSendThrottled
+}
@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"errors"
+	"fmt"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestReserveLoginAttemptConcurrently(t *testing.T) {
+	p := testRepository(t)
+	limit := models.LoginLimit{Key: fmt.Sprintf("test:%d", time.Now().UnixNano()), MaxFailures: 3}
+	t.Cleanup(func() { p.ClearLoginFailures(limit.Key) })
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	granted, refused := 0, 0
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			throttle, err := p.ReserveLoginAttempt([]models.LoginLimit{limit}, time.Hour)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ports.ErrLoginLocked):
+				refused++
+				if throttle == nil || throttle.LockedUntil == nil {
+					t.Errorf("refused without the lock: %+v", throttle)
+				}
+			case err != nil:
+				t.Errorf("reserve: %v", err)
+			default:
+				granted++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if granted != limit.MaxFailures || refused != 20-limit.MaxFailures {
+		t.Errorf("%d attempts granted, %d refused; want %d and %d", granted, refused, limit.MaxFailures, 20-limit.MaxFailures)
+	}
+
+	// a right password on the last attempt takes it back, lifting the lockout it set
+	if err := p.ReleaseLoginAttempt(limit, time.Hour); err != nil {
+		t.Fatalf("release: %v", err)
+	}
+	if _, err := p.ReserveLoginAttempt([]models.LoginLimit{limit}, time.Hour); err != nil {
+		t.Errorf("reserve after release: %v", err)
+	}
+	if _, err := p.ReserveLoginAttempt([]models.LoginLimit{limit}, time.Hour); !errors.Is(err, ports.ErrLoginLocked) {
+		t.Errorf("reserve after the lockout: got %v, want %v", err, ports.ErrLoginLocked)
+	}
+}
+
+func TestReserveSendConcurrently(t *testing.T) {
+	p := testRepository(t)
+	key := fmt.Sprintf("test-send:%d", time.Now().UnixNano())
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	sent, refused := 0, 0
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			next, err := p.ReserveSend(key, time.Hour)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case errors.Is(err, ports.ErrSendThrottled):
+				refused++
+				if wait := time.Until(next); wait <= 0 || wait > time.Hour {
+					t.Errorf("next send in %v, want within the hour", wait)
+				}
+			case err != nil:
+				t.Errorf("reserve: %v", err)
+			default:
+				sent++
+			}
+		}()
+	}
+	wg.Wait()
+
+	if sent != 1 || refused != 9 {
+		t.Errorf("%d sent, %d refused; want 1 and 9", sent, refused)
+	}
+	// once the interval has passed the key can send again
+	if _, err := p.ReserveSend(key, 0); err != nil {
+		t.Errorf("reserve after the interval: %v", err)
+	}
+}
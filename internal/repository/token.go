@@ -1,12 +1,42 @@
 package repository
 
-import "payment-system-one/internal/models"
+import (
+	"errors"
+	"payment-system-one/internal/models"
+	"time"
 
-// TokenInBlacklist checks if token is already in the blacklist collection
-func (p *Postgres) TokenInBlacklist(token *string) bool {
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// TokenInBlacklist checks if the access token with tokenID (its jti) has been revoked. Only a
+// missing entry means it has not: any other error is returned so callers can refuse the token.
+func (p *Postgres) TokenInBlacklist(tokenID string) (bool, error) {
 	tok := &models.Blacklist{}
-	if err := p.DB.Where("token = ?", token).First(&tok).Error; err != nil {
-		return false
+	err := p.DB.Where("token_id = ?", tokenID).First(&tok).Error
+	if errors.Is(err, gorm.ErrRecordNotFound) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
 	}
-	return true
+	return true, nil
+}
+
+// BlacklistToken revokes the access token with tokenID until it expires
+func (p *Postgres) BlacklistToken(tokenID string, expiresAt time.Time) error {
+	return blacklistToken(p.DB, tokenID, expiresAt)
+}
+
+// PruneBlacklist deletes the entries of tokens that have expired since they were revoked
+func (p *Postgres) PruneBlacklist() (int64, error) {
+	result := p.DB.Where("expires_at <= ?", time.Now()).Delete(&models.Blacklist{})
+	return result.RowsAffected, result.Error
+}
+
+func blacklistToken(tx *gorm.DB, tokenID string, expiresAt time.Time) error {
+	return tx.Clauses(clause.OnConflict{DoNothing: true}).Create(&models.Blacklist{
+		TokenID:   tokenID,
+		ExpiresAt: expiresAt,
+	}).Error
 }
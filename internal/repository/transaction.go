@@ -0,0 +1,91 @@
+package repository
+
+import (
+	"errors"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// FindTransaction returns a transaction by its id
+func (p *Postgres) FindTransaction(id uint) (*models.Transaction, error) {
+	transaction := &models.Transaction{}
+	if err := p.DB.First(transaction, id).Error; err != nil {
+		return nil, notFound(err, ports.ErrTransactionNotFound)
+	}
+	return transaction, nil
+}
+
+// FindTransactionByReference returns a transaction by the reference given to customers
+func (p *Postgres) FindTransactionByReference(reference string) (*models.Transaction, error) {
+	transaction := &models.Transaction{}
+	if err := p.DB.Where("reference = ?", reference).First(transaction).Error; err != nil {
+		return nil, notFound(err, ports.ErrTransactionNotFound)
+	}
+	return transaction, nil
+}
+
+// CreatePendingTransaction records a transaction that has started but not yet completed or failed
+func (p *Postgres) CreatePendingTransaction(transaction *models.Transaction) error {
+	transaction.Status = models.TransactionPending
+	if transaction.TransactionDate.IsZero() {
+		transaction.TransactionDate = time.Now()
+	}
+	return p.DB.Create(transaction).Error
+}
+
+// transitionTransaction moves a locked transaction to status, returning ports.ErrIllegalTransition
+// if its current status does not allow it
+func transitionTransaction(tx *gorm.DB, transaction *models.Transaction, status, reason string) error {
+	if !models.CanTransition(transaction.Status, status) {
+		return ports.ErrIllegalTransition
+	}
+
+	transaction.SetStatus(status, reason, time.Now())
+	return tx.Model(transaction).Select("status", "failure_reason", "completed_at", "failed_at", "reversed_at").
+		Updates(transaction).Error
+}
+
+// updateTransactionStatus locks the transaction with id and moves it to status
+func updateTransactionStatus(tx *gorm.DB, id uint, status, reason string) (*models.Transaction, error) {
+	transaction := &models.Transaction{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).First(transaction, id).Error; err != nil {
+		return nil, notFound(err, ports.ErrTransactionNotFound)
+	}
+	if err := transitionTransaction(tx, transaction, status, reason); err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// UpdateTransactionStatus moves a transaction to status. The row is locked so that two
+// concurrent updates cannot both pass the transition check.
+func (p *Postgres) UpdateTransactionStatus(id uint, status, reason string) (*models.Transaction, error) {
+	var transaction *models.Transaction
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		var err error
+		transaction, err = updateTransactionStatus(tx, id, status, reason)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
+}
+
+// failureReason is the reason recorded on a transaction that failed with err
+func failureReason(err error) string {
+	switch {
+	case errors.Is(err, ports.ErrInsufficientFunds):
+		return models.FailureInsufficientFunds
+	case errors.Is(err, ports.ErrWalletNotFound):
+		return models.FailureAccountNotFound
+	case errors.Is(err, ports.ErrCurrencyMismatch):
+		return models.FailureCurrencyMismatch
+	default:
+		return models.FailureInternalError
+	}
+}
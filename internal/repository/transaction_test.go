@@ -0,0 +1,71 @@
+package repository
+
+import (
+	"errors"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"testing"
+)
+
+func TestUpdateTransactionStatus(t *testing.T) {
+	p := testRepository(t)
+	user := createTestUser(t, p, models.NewMoney(0, models.DefaultCurrency))
+
+	pending := func() *models.Transaction {
+		t.Helper()
+		transaction := &models.Transaction{
+			PayerAccountNumber: user.AccountNo,
+			TransactionType:    "debit",
+			TransactionAmount:  models.NewMoney(100, models.DefaultCurrency),
+			TransactionFee:     models.NewMoney(0, models.DefaultCurrency),
+		}
+		if err := p.CreatePendingTransaction(transaction); err != nil {
+			t.Fatalf("create pending transaction: %v", err)
+		}
+		if transaction.Status != models.TransactionPending {
+			t.Fatalf("new transaction is %q, want pending", transaction.Status)
+		}
+		return transaction
+	}
+
+	completed := pending()
+	updated, err := p.UpdateTransactionStatus(completed.ID, models.TransactionCompleted, "")
+	if err != nil {
+		t.Fatalf("complete: %v", err)
+	}
+	if updated.Status != models.TransactionCompleted || updated.CompletedAt == nil {
+		t.Errorf("completed transaction = %+v", updated)
+	}
+	for _, status := range []string{models.TransactionPending, models.TransactionFailed, models.TransactionCompleted} {
+		if _, err := p.UpdateTransactionStatus(completed.ID, status, ""); !errors.Is(err, ports.ErrIllegalTransition) {
+			t.Errorf("completed to %s: got %v, want ErrIllegalTransition", status, err)
+		}
+	}
+	if _, err := p.UpdateTransactionStatus(completed.ID, models.TransactionReversed, ""); err != nil {
+		t.Errorf("reverse: %v", err)
+	}
+
+	failed := pending()
+	if _, err := p.UpdateTransactionStatus(failed.ID, models.TransactionReversed, ""); !errors.Is(err, ports.ErrIllegalTransition) {
+		t.Errorf("pending to reversed: got %v, want ErrIllegalTransition", err)
+	}
+	if _, err := p.UpdateTransactionStatus(failed.ID, models.TransactionFailed, models.FailureProviderError); err != nil {
+		t.Fatalf("fail: %v", err)
+	}
+	stored, err := p.FindTransaction(failed.ID)
+	if err != nil {
+		t.Fatalf("find: %v", err)
+	}
+	if stored.Status != models.TransactionFailed || stored.FailureReason != models.FailureProviderError || stored.FailedAt == nil {
+		t.Errorf("failed transaction = %+v", stored)
+	}
+	for _, status := range []string{models.TransactionCompleted, models.TransactionReversed} {
+		if _, err := p.UpdateTransactionStatus(failed.ID, status, ""); !errors.Is(err, ports.ErrIllegalTransition) {
+			t.Errorf("failed to %s: got %v, want ErrIllegalTransition", status, err)
+		}
+	}
+
+	if _, err := p.UpdateTransactionStatus(1<<31-1, models.TransactionCompleted, ""); !errors.Is(err, ports.ErrTransactionNotFound) {
+		t.Errorf("missing transaction: got %v, want ErrTransactionNotFound", err)
+	}
+}
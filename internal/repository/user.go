@@ -1,25 +1,42 @@
 package repository
 
 import (
+	"errors"
+	"fmt"
 	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
 	"time"
+
+	"gorm.io/gorm"
 )
 
 func (p *Postgres) FindUserByEmail(email string) (*models.User, error) {
 	user := &models.User{}
 
 	if err := p.DB.Where("email = ?", email).First(&user).Error; err != nil {
-		return nil, err
+		return nil, notFound(err, ports.ErrUserNotFound)
+	}
+	return user, nil
+}
+
+func (p *Postgres) FindUserByID(id uint) (*models.User, error) {
+	user := &models.User{}
+
+	if err := p.DB.First(user, id).Error; err != nil {
+		return nil, notFound(err, ports.ErrUserNotFound)
 	}
 	return user, nil
 }
 
-// create a user in thye database
+// create a user in thye database, with an empty wallet in the default currency
 func (p *Postgres) CreateUser(user *models.User) error {
-	if err := p.DB.Create(user).Error; err != nil {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Create(user).Error; err != nil {
+			return err
+		}
+		_, err := openWallet(tx, user, models.DefaultCurrency)
 		return err
-	}
-	return nil
+	})
 }
 
 func (p *Postgres) UpdateUser(user *models.User) error {
@@ -31,60 +48,237 @@ func (p *Postgres) UpdateUser(user *models.User) error {
 
 // FindUserByAccountNumber
 func (p *Postgres) FindUserByAccountNumber(accountNumber int) (*models.User, error) {
+	return findUserByAccountNumber(p.DB, accountNumber)
+}
+
+func findUserByAccountNumber(tx *gorm.DB, accountNumber int) (*models.User, error) {
 	user := &models.User{}
 
-	if err := p.DB.Where("account_no = ?", accountNumber).First(&user).Error; err != nil {
-		return nil, err
+	if err := tx.Where("account_no = ?", accountNumber).First(&user).Error; err != nil {
+		return nil, notFound(err, ports.ErrUserNotFound)
 	}
 	return user, nil
 }
 
-// TransferFunds
-func (p *Postgres) TransferFunds(user *models.User, recipient *models.User, amount float64) error {
-	tx := p.DB.Begin()
-
-	// deduct the amount from the payer
-	user.AvailableBalance -= amount
-	// add the amount to the recipient
-	recipient.AvailableBalance += amount
-
-	// save the transaction for the payer
-	if err := tx.Save(user).Error; err != nil {
-		tx.Rollback()
-		return err
+// TransferFunds moves amount from the user's wallet in its currency to the recipient's wallet
+// in the same currency, charging the user fee on top. Both wallets are locked and the payer's
+// balance is checked again inside the database transaction, so concurrent transfers cannot
+// overdraw it; ports.ErrInsufficientFunds is returned when it is too low, ports.ErrWalletNotFound
+// when the user does not hold the currency and ports.ErrCurrencyMismatch when the recipient does
+// not. The movements are posted to the ledger and the stored balances follow the postings. The
+// transfer is recorded as pending first and then moved to completed, or to failed with the
+// reason when it does not go through.
+func (p *Postgres) TransferFunds(user *models.User, recipient *models.User, amount models.Money, fee models.Money) (*models.Transaction, error) {
+	if user.ID == recipient.ID {
+		return nil, ports.ErrSameAccount
 	}
-
-	// save the transaction for the recipient
-	if err := tx.Save(recipient).Error; err != nil {
-		tx.Rollback()
-		return err
+	if !amount.SameCurrency(fee) {
+		return nil, ports.ErrCurrencyMismatch
 	}
 
-	// save the transaction in the transaction table
-	transaction := &models.Transaction{
+	pending := &models.Transaction{
 		PayerAccountNumber:     user.AccountNo,
 		RecipientAccountNumber: recipient.AccountNo,
 		TransactionType:        "debit",
 		TransactionAmount:      amount,
-		TransactionDate:        time.Now(),
+		TransactionFee:         fee,
 	}
+	if err := p.CreatePendingTransaction(pending); err != nil {
+		return nil, err
+	}
+
+	var transaction *models.Transaction
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		payerKey := walletKey{user.ID, amount.Currency}
+		payeeKey := walletKey{recipient.ID, amount.Currency}
+		locked, err := lockWallets(tx, payerKey, payeeKey)
+		if err == gorm.ErrRecordNotFound {
+			if _, ok := locked[payerKey]; !ok {
+				return ports.ErrWalletNotFound
+			}
+			return ports.ErrCurrencyMismatch
+		}
+		if err != nil {
+			return err
+		}
+		payer, payee := locked[payerKey], locked[payeeKey]
 
-	// save the transaction
-	if err := tx.Create(transaction).Error; err != nil {
-		tx.Rollback()
+		if payer.Balance.Minor < amount.Minor+fee.Minor {
+			return ports.ErrInsufficientFunds
+		}
+
+		payerAccount, err := userLedgerAccount(tx, payer)
+		if err != nil {
+			return err
+		}
+		recipientAccount, err := userLedgerAccount(tx, payee)
+		if err != nil {
+			return err
+		}
+
+		entry, err := postJournalEntry(tx, models.JournalTransfer,
+			fmt.Sprintf("transfer from %d to %d", payer.AccountNo, payee.AccountNo),
+			transferPostings(payerAccount, recipientAccount, amount))
+		if err != nil {
+			return err
+		}
+
+		if fee.Minor > 0 {
+			feesAccount, err := systemLedgerAccount(tx, models.LedgerFeesAccount, models.LedgerKindRevenue, fee.Currency)
+			if err != nil {
+				return err
+			}
+			if _, err := postJournalEntry(tx, models.JournalFee,
+				fmt.Sprintf("transfer fee on %d", payer.AccountNo),
+				transferPostings(payerAccount, feesAccount, fee)); err != nil {
+				return err
+			}
+		}
+
+		// deduct the amount and fee from the payer
+		if err := adjustBalance(tx, payer, -(amount.Minor + fee.Minor)); err != nil {
+			return err
+		}
+
+		// add the amount to the recipient
+		if err := adjustBalance(tx, payee, amount.Minor); err != nil {
+			return err
+		}
+
+		// link the ledger entry and complete the pending transaction
+		if err := tx.Model(pending).Update("journal_entry_id", entry.ID).Error; err != nil {
+			return err
+		}
+		transaction, err = updateTransactionStatus(tx, pending.ID, models.TransactionCompleted, "")
 		return err
+	})
+	if err != nil {
+		if _, failErr := p.UpdateTransactionStatus(pending.ID, models.TransactionFailed, failureReason(err)); failErr != nil {
+			return nil, errors.Join(err, failErr)
+		}
+		return nil, err
 	}
+	return transaction, nil
+}
 
-	tx.Commit()
-	return nil
+// AddFunds tops up the user's wallet in the amount's currency from the funding account,
+// opening the wallet if the user does not hold that currency yet
+func (p *Postgres) AddFunds(user *models.User, amount models.Money) (*models.Transaction, error) {
+	transaction := &models.Transaction{}
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		if _, err := openWallet(tx, user, amount.Currency); err != nil {
+			return err
+		}
+
+		key := walletKey{user.ID, amount.Currency}
+		locked, err := lockWallets(tx, key)
+		if err != nil {
+			return err
+		}
+		wallet := locked[key]
+
+		account, err := userLedgerAccount(tx, wallet)
+		if err != nil {
+			return err
+		}
+		funding, err := systemLedgerAccount(tx, models.LedgerFundingAccount, models.LedgerKindAsset, amount.Currency)
+		if err != nil {
+			return err
+		}
+
+		entry, err := postJournalEntry(tx, models.JournalTopUp,
+			fmt.Sprintf("top up of %d", wallet.AccountNo),
+			transferPostings(funding, account, amount))
+		if err != nil {
+			return err
+		}
+
+		//add the amount to the user's wallet
+		if err := adjustBalance(tx, wallet, amount.Minor); err != nil {
+			return err
+		}
+
+		transaction.RecipientAccountNumber = wallet.AccountNo
+		transaction.TransactionType = "credit"
+		transaction.TransactionAmount = amount
+		transaction.TransactionFee = models.NewMoney(0, amount.Currency)
+		transaction.TransactionDate = time.Now()
+		transaction.JournalEntryID = entry.ID
+		transaction.SetStatus(models.TransactionCompleted, "", transaction.TransactionDate)
+		return tx.Create(transaction).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return transaction, nil
 }
 
-// Transaction
-func (p *Postgres) Transaction(account_no int) ([]models.Transaction, error) {
-	transactions := []models.Transaction{}
+// Transactions returns a page of an account's transactions matching the filter, sorted by date
+// and then id so that the cursor of the last row marks exactly where the next page starts
+func (p *Postgres) Transactions(filter models.TransactionFilter) (*models.TransactionPage, error) {
+	query := p.DB.Model(&models.Transaction{})
+
+	switch filter.Direction {
+	case models.DirectionIncoming:
+		query = query.Where("recipient_account_number = ?", filter.AccountNo)
+	case models.DirectionOutgoing:
+		query = query.Where("payer_account_number = ?", filter.AccountNo)
+	default:
+		query = query.Where("(payer_account_number = ? OR recipient_account_number = ?)", filter.AccountNo, filter.AccountNo)
+	}
+
+	if filter.Counterparty != 0 {
+		query = query.Where("((payer_account_number = ? AND recipient_account_number = ?) OR (payer_account_number = ? AND recipient_account_number = ?))",
+			filter.AccountNo, filter.Counterparty, filter.Counterparty, filter.AccountNo)
+	}
+	if !filter.From.IsZero() {
+		query = query.Where("transaction_date >= ?", filter.From)
+	}
+	if !filter.To.IsZero() {
+		query = query.Where("transaction_date < ?", filter.To)
+	}
+	if filter.Currency != "" {
+		query = query.Where("transaction_amount_currency = ?", filter.Currency)
+	}
+	if filter.MinAmount != nil {
+		query = query.Where("transaction_amount_minor >= ?", *filter.MinAmount)
+	}
+	if filter.MaxAmount != nil {
+		query = query.Where("transaction_amount_minor <= ?", *filter.MaxAmount)
+	}
+	if filter.Status != "" {
+		query = query.Where("status = ?", filter.Status)
+	}
+
+	order := "transaction_date DESC, id DESC"
+	if filter.Ascending {
+		order = "transaction_date ASC, id ASC"
+	}
+	if filter.Cursor != nil {
+		comparison := "<"
+		if filter.Ascending {
+			comparison = ">"
+		}
+		query = query.Where("(transaction_date, id) "+comparison+" (?, ?)", filter.Cursor.TransactionDate, filter.Cursor.ID)
+	}
+
+	limit := filter.Limit
+	if limit <= 0 || limit > models.MaxHistoryLimit {
+		limit = models.DefaultHistoryLimit
+	}
 
-	if err := p.DB.Where("payer_account_number = ? OR recipient_account_number = ?", account_no, account_no).Find(&transactions).Error; err != nil {
+	// one extra row tells us whether there is a next page
+	transactions := []models.Transaction{}
+	if err := query.Order(order).Limit(limit + 1).Find(&transactions).Error; err != nil {
 		return nil, err
 	}
-	return transactions, nil
+
+	page := &models.TransactionPage{Transactions: transactions}
+	if len(transactions) > limit {
+		page.Transactions = transactions[:limit]
+		last := page.Transactions[limit-1]
+		cursor := &models.TransactionCursor{TransactionDate: last.TransactionDate, ID: last.ID}
+		page.NextCursor = cursor.Encode()
+	}
+	return page, nil
 }
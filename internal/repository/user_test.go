@@ -0,0 +1,184 @@
+package repository
+
+import (
+	"errors"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"sync"
+	"testing"
+)
+
+func TestTransferFundsConcurrently(t *testing.T) {
+	p := testRepository(t)
+
+	const transfers = 25
+	amount := models.NewMoney(1000, models.DefaultCurrency)
+	fee := models.NewMoney(50, models.DefaultCurrency)
+	// enough for 10 transfers and part of an 11th
+	funds := models.NewMoney(10*(amount.Minor+fee.Minor)+amount.Minor/2, models.DefaultCurrency)
+
+	payer := createTestUser(t, p, funds)
+	payee := createTestUser(t, p, models.NewMoney(0, models.DefaultCurrency))
+
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	succeeded := 0
+	for i := 0; i < transfers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := p.TransferFunds(payer, payee, amount, fee)
+			mu.Lock()
+			defer mu.Unlock()
+			switch {
+			case err == nil:
+				succeeded++
+			case !errors.Is(err, ports.ErrInsufficientFunds):
+				t.Errorf("transfer: %v", err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if succeeded != 10 {
+		t.Errorf("%d transfers succeeded, want 10", succeeded)
+	}
+
+	payerWallet, err := p.FindWallet(payer, models.DefaultCurrency)
+	if err != nil {
+		t.Fatalf("find payer wallet: %v", err)
+	}
+	if payerWallet.Balance.Minor < 0 {
+		t.Errorf("payer balance is %d, below zero", payerWallet.Balance.Minor)
+	}
+	if debited := funds.Minor - payerWallet.Balance.Minor; debited != int64(succeeded)*(amount.Minor+fee.Minor) {
+		t.Errorf("payer was debited %d for %d transfers of %d plus %d fee", debited, succeeded, amount.Minor, fee.Minor)
+	}
+
+	payeeWallet, err := p.FindWallet(payee, models.DefaultCurrency)
+	if err != nil {
+		t.Fatalf("find payee wallet: %v", err)
+	}
+	if payeeWallet.Balance.Minor != int64(succeeded)*amount.Minor {
+		t.Errorf("payee balance is %d, want %d", payeeWallet.Balance.Minor, int64(succeeded)*amount.Minor)
+	}
+
+	for _, user := range []*models.User{payer, payee} {
+		reconciliations, err := p.ReconcileBalance(user.AccountNo)
+		if err != nil {
+			t.Fatalf("reconcile %d: %v", user.AccountNo, err)
+		}
+		for _, reconciliation := range reconciliations {
+			if !reconciliation.Balanced {
+				t.Errorf("wallet %d is off its ledger by %d", user.AccountNo, reconciliation.Difference.Minor)
+			}
+		}
+	}
+
+	var totals struct {
+		Debits  int64
+		Credits int64
+	}
+	if err := p.DB.Model(&models.Posting{}).
+		Select("COALESCE(SUM(debit), 0) AS debits, COALESCE(SUM(credit), 0) AS credits").
+		Scan(&totals).Error; err != nil {
+		t.Fatalf("sum postings: %v", err)
+	}
+	if totals.Debits != totals.Credits {
+		t.Errorf("ledger debits %d do not equal credits %d", totals.Debits, totals.Credits)
+	}
+}
+
+func TestTransferFundsRecordsStatus(t *testing.T) {
+	p := testRepository(t)
+
+	amount := models.NewMoney(1000, models.DefaultCurrency)
+	fee := models.NewMoney(50, models.DefaultCurrency)
+	payer := createTestUser(t, p, models.NewMoney(amount.Minor+fee.Minor, models.DefaultCurrency))
+	payee := createTestUser(t, p, models.NewMoney(0, models.DefaultCurrency))
+
+	completed, err := p.TransferFunds(payer, payee, amount, fee)
+	if err != nil {
+		t.Fatalf("transfer: %v", err)
+	}
+	if completed.Status != models.TransactionCompleted || completed.CompletedAt == nil || completed.JournalEntryID == 0 {
+		t.Errorf("transfer is %q, completed at %v with journal entry %d", completed.Status, completed.CompletedAt, completed.JournalEntryID)
+	}
+
+	if _, err := p.TransferFunds(payer, payee, amount, fee); !errors.Is(err, ports.ErrInsufficientFunds) {
+		t.Fatalf("second transfer: got %v, want %v", err, ports.ErrInsufficientFunds)
+	}
+	failed := &models.Transaction{}
+	if err := p.DB.Where("payer_account_number = ? AND status = ?", payer.AccountNo, models.TransactionFailed).
+		First(failed).Error; err != nil {
+		t.Fatalf("find failed transfer: %v", err)
+	}
+	if failed.FailureReason != models.FailureInsufficientFunds || failed.FailedAt == nil || failed.JournalEntryID != 0 {
+		t.Errorf("failed transfer has reason %q, failed at %v with journal entry %d",
+			failed.FailureReason, failed.FailedAt, failed.JournalEntryID)
+	}
+}
+
+func TestTransactionsKeysetPaging(t *testing.T) {
+	p := testRepository(t)
+
+	const transfers = 5
+	amount := models.NewMoney(100, models.DefaultCurrency)
+	fee := models.NewMoney(0, models.DefaultCurrency)
+	payer := createTestUser(t, p, models.NewMoney(transfers*amount.Minor, models.DefaultCurrency))
+	payee := createTestUser(t, p, models.NewMoney(0, models.DefaultCurrency))
+
+	created := []uint{}
+	for i := 0; i < transfers; i++ {
+		transaction, err := p.TransferFunds(payer, payee, amount, fee)
+		if err != nil {
+			t.Fatalf("transfer %d: %v", i, err)
+		}
+		created = append(created, transaction.ID)
+	}
+
+	for _, ascending := range []bool{true, false} {
+		want := make([]uint, len(created))
+		for i, id := range created {
+			if ascending {
+				want[i] = id
+			} else {
+				want[len(created)-1-i] = id
+			}
+		}
+
+		got := []uint{}
+		filter := models.TransactionFilter{AccountNo: payee.AccountNo, Ascending: ascending, Limit: 2}
+		for pages := 0; ; pages++ {
+			if pages > transfers {
+				t.Fatalf("ascending %v: paging did not end", ascending)
+			}
+			page, err := p.Transactions(filter)
+			if err != nil {
+				t.Fatalf("ascending %v: page %d: %v", ascending, pages, err)
+			}
+			if len(page.Transactions) > filter.Limit {
+				t.Errorf("ascending %v: page %d has %d transactions, limit is %d", ascending, pages, len(page.Transactions), filter.Limit)
+			}
+			for _, transaction := range page.Transactions {
+				got = append(got, transaction.ID)
+			}
+			if page.NextCursor == "" {
+				break
+			}
+			if filter.Cursor, err = models.DecodeTransactionCursor(page.NextCursor); err != nil {
+				t.Fatalf("ascending %v: decode cursor: %v", ascending, err)
+			}
+		}
+
+		if len(got) != len(want) {
+			t.Fatalf("ascending %v: paged through %v, want %v", ascending, got, want)
+		}
+		for i := range want {
+			if got[i] != want[i] {
+				t.Errorf("ascending %v: paged through %v, want %v", ascending, got, want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"time"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// CreateEmailVerification stores a verification token, replacing the user's earlier unused ones
+func (p *Postgres) CreateEmailVerification(verification *models.EmailVerification) error {
+	return p.DB.Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ? AND used_at IS NULL", verification.UserID).Delete(&models.EmailVerification{}).Error; err != nil {
+			return err
+		}
+		return tx.Create(verification).Error
+	})
+}
+
+// LastEmailVerification returns when the last verification token was sent to a user, or the zero time
+func (p *Postgres) LastEmailVerification(user *models.User) (time.Time, error) {
+	verification := &models.EmailVerification{}
+	err := p.DB.Unscoped().Where("user_id = ?", user.ID).Order("created_at DESC").First(verification).Error
+	if err == gorm.ErrRecordNotFound {
+		return time.Time{}, nil
+	}
+	if err != nil {
+		return time.Time{}, err
+	}
+	return verification.CreatedAt, nil
+}
+
+// VerifyEmail uses up the verification token with tokenHash and marks the email of its user as
+// verified. ports.ErrVerificationTokenInvalid is returned if it does not exist, has been used or has expired.
+func (p *Postgres) VerifyEmail(tokenHash string) (*models.User, error) {
+	user := &models.User{}
+	err := p.DB.Transaction(func(tx *gorm.DB) error {
+		verification := &models.EmailVerification{}
+		err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).Where("token_hash = ?", tokenHash).First(verification).Error
+		if err == gorm.ErrRecordNotFound {
+			return ports.ErrVerificationTokenInvalid
+		}
+		if err != nil {
+			return err
+		}
+
+		now := time.Now()
+		if verification.UsedAt != nil || !now.Before(verification.ExpiresAt) {
+			return ports.ErrVerificationTokenInvalid
+		}
+		if err := tx.Model(verification).Update("used_at", now).Error; err != nil {
+			return err
+		}
+
+		if err := tx.First(user, verification.UserID).Error; err != nil {
+			return err
+		}
+		if user.IsEmailVerified() {
+			return nil
+		}
+		return tx.Model(user).Update("email_verified_at", now).Error
+	})
+	if err != nil {
+		return nil, err
+	}
+	return user, nil
+}
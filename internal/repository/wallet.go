@@ -0,0 +1,95 @@
+package repository
+
+import (
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/ports"
+	"strings"
+
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// walletKey identifies a wallet by its owner and currency
+type walletKey struct {
+	UserID   uint
+	Currency string
+}
+
+// lockWallets loads the wallets with SELECT ... FOR UPDATE. Rows are always locked in
+// ascending id order so that two transfers between the same wallets cannot deadlock.
+// gorm.ErrRecordNotFound is returned along with the wallets that were found if any of them does not exist.
+func lockWallets(tx *gorm.DB, keys ...walletKey) (map[walletKey]*models.Wallet, error) {
+	conditions := make([]string, 0, len(keys))
+	args := make([]interface{}, 0, 2*len(keys))
+	for _, key := range keys {
+		conditions = append(conditions, "(user_id = ? AND balance_currency = ?)")
+		args = append(args, key.UserID, key.Currency)
+	}
+
+	wallets := []*models.Wallet{}
+	if err := tx.Clauses(clause.Locking{Strength: "UPDATE"}).
+		Where(strings.Join(conditions, " OR "), args...).Order("id").Find(&wallets).Error; err != nil {
+		return nil, err
+	}
+
+	locked := make(map[walletKey]*models.Wallet, len(wallets))
+	for _, wallet := range wallets {
+		locked[walletKey{wallet.UserID, wallet.Currency()}] = wallet
+	}
+	for _, key := range keys {
+		if _, ok := locked[key]; !ok {
+			return locked, gorm.ErrRecordNotFound
+		}
+	}
+	return locked, nil
+}
+
+// adjustBalance atomically adds delta minor units to the wallet's stored balance
+func adjustBalance(tx *gorm.DB, wallet *models.Wallet, delta int64) error {
+	err := tx.Model(&models.Wallet{}).Where("id = ?", wallet.ID).
+		UpdateColumn("balance_minor", gorm.Expr("balance_minor + ?", delta)).Error
+	if err != nil {
+		return err
+	}
+	wallet.Balance.Minor += delta
+	return nil
+}
+
+// openWallet creates the user's wallet in currency if they do not hold one yet
+func openWallet(tx *gorm.DB, user *models.User, currency string) (*models.Wallet, error) {
+	wallet := &models.Wallet{
+		UserID:    user.ID,
+		AccountNo: user.AccountNo,
+		Balance:   models.NewMoney(0, currency),
+	}
+	if err := tx.Clauses(clause.OnConflict{DoNothing: true}).Create(wallet).Error; err != nil {
+		return nil, err
+	}
+	if err := tx.Where("user_id = ? AND balance_currency = ?", user.ID, currency).First(wallet).Error; err != nil {
+		return nil, err
+	}
+	return wallet, nil
+}
+
+// OpenWallet opens a wallet for the user in currency, returning the existing one if they already hold it
+func (p *Postgres) OpenWallet(user *models.User, currency string) (*models.Wallet, error) {
+	return openWallet(p.DB, user, currency)
+}
+
+// FindWallet returns the user's wallet in currency
+func (p *Postgres) FindWallet(user *models.User, currency string) (*models.Wallet, error) {
+	wallet := &models.Wallet{}
+	if err := p.DB.Where("user_id = ? AND balance_currency = ?", user.ID, currency).First(wallet).Error; err != nil {
+		return nil, notFound(err, ports.ErrWalletNotFound)
+	}
+	return wallet, nil
+}
+
+// Wallets returns all the wallets of a user
+func (p *Postgres) Wallets(user *models.User) ([]models.Wallet, error) {
+	wallets := []models.Wallet{}
+	if err := p.DB.Where("user_id = ?", user.ID).Order("id").Find(&wallets).Error; err != nil {
+		return nil, err
+	}
+	return wallets, nil
+}
@@ -0,0 +1,49 @@
+package util
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// pdfEscaper escapes the characters that end or escape a PDF string literal
+var pdfEscaper = strings.NewReplacer(`\`, `\\`, "(", `\(`, ")", `\)`, "\r", "", "\n", " ")
+
+// TextPDF renders lines of text on a single A4 page in Helvetica. The first line is the title.
+// It covers documents like receipts without pulling in a PDF library.
+func TextPDF(lines []string) []byte {
+	var content bytes.Buffer
+	content.WriteString("BT\n/F1 11 Tf\n14 TL\n56 780 Td\n")
+	for i, line := range lines {
+		if i == 0 {
+			fmt.Fprintf(&content, "/F1 16 Tf\n(%s) Tj\n/F1 11 Tf\nT* T*\n", pdfEscaper.Replace(line))
+			continue
+		}
+		fmt.Fprintf(&content, "(%s) Tj\nT*\n", pdfEscaper.Replace(line))
+	}
+	content.WriteString("ET\n")
+
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /MediaBox [0 0 595 842] /Resources << /Font << /F1 4 0 R >> >> /Contents 5 0 R >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica /Encoding /WinAnsiEncoding >>",
+		fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(), content.String()),
+	}
+
+	var pdf bytes.Buffer
+	pdf.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, object := range objects {
+		offsets[i] = pdf.Len()
+		fmt.Fprintf(&pdf, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	xref := pdf.Len()
+	fmt.Fprintf(&pdf, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, offset := range offsets {
+		fmt.Fprintf(&pdf, "%010d 00000 n \n", offset)
+	}
+	fmt.Fprintf(&pdf, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n", len(objects)+1, xref)
+	return pdf.Bytes()
+}
@@ -0,0 +1,60 @@
+package util
+
+import (
+	cryptorand "crypto/rand"
+	"errors"
+	"math/big"
+	"strings"
+)
+
+// ErrInvalidPhone is returned for numbers that cannot be put in E.164 form
+var ErrInvalidPhone = errors.New("invalid phone number")
+
+// NormalizePhone puts a phone number in E.164 form such as +2348031234567. Spaces, dashes, dots
+// and brackets are dropped, a leading 00 is read as +, and a national number with a leading 0 is
+// given the defaultCountryCode (digits only, such as 234).
+func NormalizePhone(phone string, defaultCountryCode string) (string, error) {
+	var digits strings.Builder
+	international := false
+	for i, r := range strings.TrimSpace(phone) {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == '+' && i == 0:
+			international = true
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", ErrInvalidPhone
+		}
+	}
+
+	number := digits.String()
+	switch {
+	case international:
+	case strings.HasPrefix(number, "00"):
+		number = number[2:]
+	case strings.HasPrefix(number, "0") && defaultCountryCode != "":
+		number = defaultCountryCode + number[1:]
+	default:
+		return "", ErrInvalidPhone
+	}
+
+	// E.164 numbers have at most 15 digits and country codes never start with 0
+	if len(number) < 8 || len(number) > 15 || number[0] == '0' {
+		return "", ErrInvalidPhone
+	}
+	return "+" + number, nil
+}
+
+// GenerateOTP returns a random numeric one-time code of the given length
+func GenerateOTP(length int) (string, error) {
+	code := make([]byte, length)
+	for i := range code {
+		digit, err := cryptorand.Int(cryptorand.Reader, big.NewInt(10))
+		if err != nil {
+			return "", err
+		}
+		code[i] = '0' + byte(digit.Int64())
+	}
+	return string(code), nil
+}
@@ -0,0 +1,103 @@
+package util
+
+import (
+	"crypto/hmac"
+	cryptorand "crypto/rand"
+	"crypto/sha1"
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// TOTP parameters (RFC 6238), the defaults every authenticator app supports
+const (
+	totpPeriod = 30
+	totpDigits = 6
+	// totpSkew is how many periods before and after the current one are accepted
+	totpSkew = 1
+)
+
+var totpEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// GenerateTOTPSecret returns a random 160 bit TOTP secret, base32 encoded
+func GenerateTOTPSecret() (string, error) {
+	random := make([]byte, 20)
+	if _, err := cryptorand.Read(random); err != nil {
+		return "", err
+	}
+	return totpEncoding.EncodeToString(random), nil
+}
+
+// TOTPURI returns the otpauth URI authenticator apps enrol a secret from, usually shown as a QR code
+func TOTPURI(issuer string, account string, secret string) string {
+	query := url.Values{}
+	query.Set("secret", secret)
+	query.Set("issuer", issuer)
+	query.Set("algorithm", "SHA1")
+	query.Set("digits", fmt.Sprint(totpDigits))
+	query.Set("period", fmt.Sprint(totpPeriod))
+	label := url.PathEscape(issuer + ":" + account)
+	return "otpauth://totp/" + label + "?" + strings.ReplaceAll(query.Encode(), "+", "%20")
+}
+
+// totpCode returns the code of secret for a time step
+func totpCode(key []byte, step int64) string {
+	counter := make([]byte, 8)
+	binary.BigEndian.PutUint64(counter, uint64(step))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter)
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1000000)
+}
+
+// VerifyTOTP checks code against secret at the given time, allowing one period of clock drift.
+// Only time steps after lastStep are accepted, so a code cannot be used twice; the matching
+// step is returned to be stored as the new lastStep.
+func VerifyTOTP(secret string, code string, at time.Time, lastStep int64) (int64, bool) {
+	key, err := totpEncoding.DecodeString(strings.ToUpper(secret))
+	if err != nil || len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := at.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if step <= lastStep {
+			continue
+		}
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// GenerateRecoveryCodes returns n random single-use recovery codes such as 7K3M9-QXA2B
+func GenerateRecoveryCodes(n int) ([]string, error) {
+	codes := make([]string, n)
+	for i := range codes {
+		random := make([]byte, 10)
+		if _, err := cryptorand.Read(random); err != nil {
+			return nil, err
+		}
+		for j, b := range random {
+			random[j] = referenceAlphabet[int(b)%len(referenceAlphabet)]
+		}
+		codes[i] = string(random[:5]) + "-" + string(random[5:])
+	}
+	return codes, nil
+}
+
+// HashToken returns the SHA-256 of a random token or code, hex encoded. Unlike passwords these
+// carry enough entropy to be stored with a fast hash and looked up by it.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(strings.ToUpper(strings.TrimSpace(token))))
+	return hex.EncodeToString(sum[:])
+}
@@ -1,6 +1,8 @@
 package util
 
 import (
+	cryptorand "crypto/rand"
+	"encoding/hex"
 	"math/rand"
 	"net/http"
 	"net/mail"
@@ -15,8 +17,25 @@ const (
 	max = 99999999
 )
 
+// ErrorDetail is one entry of a response's errors array. Code is machine-readable and stable,
+// Field names the request field the error is about, if any.
+type ErrorDetail struct {
+	Field   string `json:"field,omitempty"`
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
 // Response is customized to help return all responses need
 func Response(c *gin.Context, message string, status int, data interface{}, errs []string) {
+	respond(c, message, status, data, errs)
+}
+
+// DetailedResponse responds like Response with errors that carry codes and fields
+func DetailedResponse(c *gin.Context, message string, status int, data interface{}, errs []ErrorDetail) {
+	respond(c, message, status, data, errs)
+}
+
+func respond(c *gin.Context, message string, status int, data interface{}, errs interface{}) {
 	responsedata := gin.H{
 		"message":   message,
 		"data":      data,
@@ -33,6 +52,13 @@ func HashPassword(password string) (string, error) {
 	return string(bytes), err
 }
 
+// HashPIN hashes a transaction PIN. It uses a lower cost than passwords because it is checked on
+// every debit; the lockout after failed attempts is what protects the small PIN space.
+func HashPIN(pin string) (string, error) {
+	bytes, err := bcrypt.GenerateFromPassword([]byte(pin), bcrypt.DefaultCost)
+	return string(bytes), err
+}
+
 func IsValidEmail(email string) bool {
 	_, err := mail.ParseAddress(email)
 	return err == nil
@@ -42,3 +68,28 @@ func GenerateAccountNumber() (int, error) {
 	rand.Seed(time.Now().UnixNano())
 	return rand.Intn(max-min+1) + min, nil
 }
+
+// GenerateTokenID returns a random 128 bit identifier, hex encoded
+func GenerateTokenID() (string, error) {
+	random := make([]byte, 16)
+	if _, err := cryptorand.Read(random); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(random), nil
+}
+
+// referenceAlphabet is Crockford's base32 alphabet, which leaves out letters easily mistaken for digits
+const referenceAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// GenerateReference returns a human-friendly transaction reference such as TRX-20240521-7K3M9QXA2B.
+// The random part comes from crypto/rand and carries 50 bits of entropy per day.
+func GenerateReference(at time.Time) (string, error) {
+	random := make([]byte, 10)
+	if _, err := cryptorand.Read(random); err != nil {
+		return "", err
+	}
+	for i, b := range random {
+		random[i] = referenceAlphabet[int(b)%len(referenceAlphabet)]
+	}
+	return "TRX-" + at.Format("20060102") + "-" + string(random), nil
+}
@@ -0,0 +1,203 @@
+// Package validation declares the rules request models are checked against with binding tags,
+// and turns failed checks into field-level errors with machine-readable codes.
+package validation
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"payment-system-one/internal/models"
+	"payment-system-one/internal/util"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"github.com/gin-gonic/gin/binding"
+	"github.com/go-playground/validator/v10"
+)
+
+// Codes of the field errors, stable for clients to match on
+const (
+	CodeMalformedBody       = "MALFORMED_BODY"
+	CodeInvalidType         = "INVALID_TYPE"
+	CodeRequired            = "REQUIRED"
+	CodeTooShort            = "TOO_SHORT"
+	CodeTooLong             = "TOO_LONG"
+	CodeTooSmall            = "TOO_SMALL"
+	CodeTooLarge            = "TOO_LARGE"
+	CodeInvalidLength       = "INVALID_LENGTH"
+	CodeNotNumeric          = "NOT_NUMERIC"
+	CodeInvalidEmail        = "INVALID_EMAIL"
+	CodeWeakPassword        = "WEAK_PASSWORD"
+	CodeInvalidDateOfBirth  = "INVALID_DATE_OF_BIRTH"
+	CodeUnderage            = "UNDERAGE"
+	CodeInvalidPhone        = "INVALID_PHONE"
+	CodeInvalidAmount       = "INVALID_AMOUNT"
+	CodeAmountTooLarge      = "AMOUNT_TOO_LARGE"
+	CodeInvalidRate         = "INVALID_RATE"
+	CodeUnsupportedCurrency = "UNSUPPORTED_CURRENCY"
+	CodeInvalidPIN          = "INVALID_PIN"
+	CodeInvalidRole         = "INVALID_ROLE"
+	CodeMustDiffer          = "MUST_DIFFER"
+	CodeInvalid             = "INVALID"
+)
+
+// Register adds the custom rules to the validator gin binds requests with, and makes field
+// errors name fields as they are named in JSON. National phone numbers are read with
+// defaultPhoneCountryCode. It must be called before requests are served.
+func Register(defaultPhoneCountryCode string) error {
+	validate, ok := binding.Validator.Engine().(*validator.Validate)
+	if !ok {
+		return errors.New("unexpected binding validator")
+	}
+
+	validate.RegisterTagNameFunc(func(field reflect.StructField) string {
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	rules := map[string]func(string) bool{
+		"password":   models.IsStrongPassword,
+		"date":       models.IsValidDateOfBirth,
+		"adult":      models.IsAdult,
+		"amount":     models.IsValidAmount,
+		"max_amount": models.IsWithinMaxAmount,
+		"currency":   models.IsSupportedCurrency,
+		"pin":        models.IsValidPIN,
+		"role":       models.IsValidRole,
+		"rate": func(rate string) bool {
+			_, err := models.ParseRate(rate)
+			return err == nil
+		},
+		"phone": func(phone string) bool {
+			_, err := util.NormalizePhone(phone, defaultPhoneCountryCode)
+			return err == nil
+		},
+	}
+	for tag, rule := range rules {
+		rule := rule
+		err := validate.RegisterValidation(tag, func(fl validator.FieldLevel) bool {
+			return rule(fl.Field().String())
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Errors explains why binding a request failed, with an entry for every failing field
+func Errors(err error) []util.ErrorDetail {
+	var validationErrors validator.ValidationErrors
+	if errors.As(err, &validationErrors) {
+		details := make([]util.ErrorDetail, 0, len(validationErrors))
+		for _, fieldError := range validationErrors {
+			details = append(details, fieldErrorDetail(fieldError))
+		}
+		return details
+	}
+
+	var typeError *json.UnmarshalTypeError
+	if errors.As(err, &typeError) {
+		return []util.ErrorDetail{{
+			Field:   typeError.Field,
+			Code:    CodeInvalidType,
+			Message: typeError.Field + " must be a " + jsonType(typeError.Type),
+		}}
+	}
+
+	message := "request body is not valid JSON"
+	if errors.Is(err, io.EOF) {
+		message = "request body is empty"
+	}
+	return []util.ErrorDetail{{Code: CodeMalformedBody, Message: message}}
+}
+
+func fieldErrorDetail(fieldError validator.FieldError) util.ErrorDetail {
+	field := fieldError.Field()
+	detail := util.ErrorDetail{Field: field, Code: CodeInvalid, Message: field + " is invalid"}
+
+	switch fieldError.Tag() {
+	case "required":
+		detail.Code, detail.Message = CodeRequired, field+" is required"
+	case "min":
+		if fieldError.Kind() == reflect.String {
+			detail.Code, detail.Message = CodeTooShort, field+" must be at least "+fieldError.Param()+" characters"
+		} else {
+			detail.Code, detail.Message = CodeTooSmall, field+" must be at least "+fieldError.Param()
+		}
+	case "max":
+		if fieldError.Kind() == reflect.String {
+			detail.Code, detail.Message = CodeTooLong, field+" must be at most "+fieldError.Param()+" characters"
+		} else {
+			detail.Code, detail.Message = CodeTooLarge, field+" must be at most "+fieldError.Param()
+		}
+	case "len":
+		detail.Code, detail.Message = CodeInvalidLength, field+" must be "+fieldError.Param()+" characters"
+	case "numeric":
+		detail.Code, detail.Message = CodeNotNumeric, field+" must only contain digits"
+	case "email":
+		detail.Code, detail.Message = CodeInvalidEmail, field+" must be an email address"
+	case "password":
+		detail.Code, detail.Message = CodeWeakPassword, fmt.Sprintf("%s must be %d to %d characters with an upper case letter, a lower case letter and a digit",
+			field, models.MinPasswordLength, models.MaxPasswordLength)
+	case "date":
+		detail.Code, detail.Message = CodeInvalidDateOfBirth, field+" must be a past date such as 1990-05-21"
+	case "adult":
+		detail.Code, detail.Message = CodeUnderage, fmt.Sprintf("you must be at least %d years old", models.MinAge)
+	case "phone":
+		detail.Code, detail.Message = CodeInvalidPhone, field+" must be a phone number such as +2348031234567"
+	case "amount":
+		detail.Code, detail.Message = CodeInvalidAmount, field+" must be a positive decimal such as 1250.50"
+	case "max_amount":
+		detail.Code, detail.Message = CodeAmountTooLarge, fmt.Sprintf("%s must be at most %d", field, models.MaxAmount)
+	case "rate":
+		detail.Code, detail.Message = CodeInvalidRate, field+" must be a positive decimal such as 1550.25"
+	case "currency":
+		detail.Code, detail.Message = CodeUnsupportedCurrency, field+" must be a supported currency code"
+	case "pin":
+		detail.Code, detail.Message = CodeInvalidPIN, fmt.Sprintf("%s must be %d to %d digits", field, models.MinPINLength, models.MaxPINLength)
+	case "role":
+		detail.Code, detail.Message = CodeInvalidRole, field+" must be support, compliance, finance or superadmin"
+	case "nefield":
+		detail.Code, detail.Message = CodeMustDiffer, field+" must differ from "+otherField(fieldError)
+	}
+	return detail
+}
+
+// otherField is the JSON name of the field a cross-field rule compared with. Only the Go name
+// is known, request fields are named the same in snake case.
+func otherField(fieldError validator.FieldError) string {
+	var name strings.Builder
+	for i, r := range fieldError.Param() {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				name.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		name.WriteRune(r)
+	}
+	return name.String()
+}
+
+func jsonType(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "string"
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "list"
+	default:
+		return "object"
+	}
+}